@@ -0,0 +1,122 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/thecsw/katya/storage"
+)
+
+// AssociationScores are the association measures of a node and a collocate,
+// computed from their co-occurrences in the windows around the node
+type AssociationScores struct {
+	// MI is the pointwise mutual information, it favors rare collocates
+	MI float64 `json:"mi"`
+	// MI3 is the cubed MI, which brings frequent collocates back up
+	MI3 float64 `json:"mi3"`
+	// TScore is the t-score, it favors frequent collocates
+	TScore float64 `json:"t_score"`
+	// LogLikelihood is Dunning's log-likelihood (G2) of the co-occurrence
+	LogLikelihood float64 `json:"log_likelihood"`
+	// LogDice is the logDice, which doesn't depend on the corpus size
+	LogDice float64 `json:"log_dice"`
+}
+
+var (
+	// AssociationMeasures maps the names of the measures to the
+	// values that the relations are sorted by, freq is the raw count
+	AssociationMeasures = map[string]func(r Relation) float64{
+		"freq":           func(r Relation) float64 { return float64(r.Occured) },
+		"mi":             func(r Relation) float64 { return r.Scores.MI },
+		"mi3":            func(r Relation) float64 { return r.Scores.MI3 },
+		"t_score":        func(r Relation) float64 { return r.Scores.TScore },
+		"log_likelihood": func(r Relation) float64 { return r.Scores.LogLikelihood },
+		"log_dice":       func(r Relation) float64 { return r.Scores.LogDice },
+	}
+)
+
+// CountLemmas counts every lemma of the texts, the same way FindRelations
+// sees them, and returns the counts with the total number of tokens
+func CountLemmas(texts []storage.Text) (map[string]uint, uint) {
+	counts := make(map[string]uint)
+	total := uint(0)
+	for _, text := range texts {
+		for _, lemma := range strings.Split(text.Lemmas, " ") {
+			counts[lemma]++
+			total++
+		}
+	}
+	return counts, total
+}
+
+// ScoreRelations fills the corpus frequencies and association scores of the
+// relations of the target, span is the number of tokens in a single window
+func ScoreRelations(relations map[string]*Relation, target string, counts map[string]uint, numTokens uint, span int) {
+	for lemma, relation := range relations {
+		relation.Frequency = counts[lemma]
+		relation.Scores = associationScores(
+			float64(relation.Occured),
+			float64(counts[target]),
+			float64(counts[lemma]),
+			float64(numTokens),
+			float64(span),
+		)
+	}
+}
+
+// associationScores computes the measures out of the observed co-occurrences,
+// the frequencies of the node and the collocate, the corpus size and the span,
+// the expected co-occurrences are adjusted for the span, as in Evert (2008)
+func associationScores(observed, nodeFreq, collocateFreq, size, span float64) AssociationScores {
+	scores := AssociationScores{}
+	if observed <= 0 || nodeFreq <= 0 || collocateFreq <= 0 || size <= 0 || span <= 0 {
+		return scores
+	}
+	// Contingency table of the window positions against the collocate
+	r1, c1 := nodeFreq*span, collocateFreq
+	expected := r1 * c1 / size
+	scores.MI = math.Log2(observed / expected)
+	scores.MI3 = math.Log2(math.Pow(observed, 3) / expected)
+	scores.TScore = (observed - expected) / math.Sqrt(observed)
+	scores.LogDice = 14 + math.Log2(2*observed/(nodeFreq+collocateFreq))
+
+	cells := [4][2]float64{
+		{observed, expected},
+		{r1 - observed, r1 * (size - c1) / size},
+		{c1 - observed, (size - r1) * c1 / size},
+		{size - r1 - c1 + observed, (size - r1) * (size - c1) / size},
+	}
+	for _, cell := range cells {
+		// Windows overlap, so the marginals can be exceeded, skip such cells
+		if cell[0] > 0 && cell[1] > 0 {
+			scores.LogLikelihood += cell[0] * math.Log(cell[0]/cell[1])
+		}
+	}
+	scores.LogLikelihood *= 2
+	return scores
+}
+
+// FilterMinFrequency drops the relations that co-occurred fewer than minFreq times
+func FilterMinFrequency(p PairList, minFreq int) PairList {
+	filtered := make(PairList, 0, len(p))
+	for _, v := range p {
+		if v.Value.Occured >= minFreq {
+			filtered = append(filtered, v)
+		}
+	}
+	return filtered
+}
+
+// SortByMeasure sorts the relations by the measure in descending order,
+// the measure has to be one of AssociationMeasures
+func SortByMeasure(p PairList, measure string) {
+	score := AssociationMeasures[measure]
+	sort.SliceStable(p, func(i, j int) bool {
+		a, b := score(p[i].Value), score(p[j].Value)
+		if a != b {
+			return a > b
+		}
+		return p[i].Key < p[j].Key
+	})
+}
@@ -0,0 +1,51 @@
+package analysis
+
+import (
+	"math"
+	"testing"
+)
+
+func Test_associationScores(t *testing.T) {
+	tests := []struct {
+		name                            string
+		observed, node, collocate, size float64
+		span                            float64
+		want                            AssociationScores
+	}{
+		{"no co-occurrences", 0, 10, 10, 1000, 2, AssociationScores{}},
+		{
+			"independent",
+			2, 10, 100, 1000, 2,
+			AssociationScores{MI: 0, MI3: 2, TScore: 0, LogLikelihood: 0, LogDice: 14 + math.Log2(4.0/110)},
+		},
+		{
+			"attracted",
+			8, 10, 10, 1000, 2,
+			AssociationScores{
+				MI:      math.Log2(8 / 0.2),
+				MI3:     math.Log2(512 / 0.2),
+				TScore:  (8 - 0.2) / math.Sqrt(8),
+				LogDice: 14 + math.Log2(16.0/20),
+				LogLikelihood: 2 * (8*math.Log(8/0.2) + 12*math.Log(12/(20*990.0/1000)) +
+					2*math.Log(2/(980*10.0/1000)) + 978*math.Log(978/(980*990.0/1000))),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := associationScores(tt.observed, tt.node, tt.collocate, tt.size, tt.span)
+			for _, v := range [][2]float64{
+				{got.MI, tt.want.MI},
+				{got.MI3, tt.want.MI3},
+				{got.TScore, tt.want.TScore},
+				{got.LogLikelihood, tt.want.LogLikelihood},
+				{got.LogDice, tt.want.LogDice},
+			} {
+				if math.Abs(v[0]-v[1]) > 1e-9 {
+					t.Errorf("associationScores() = %+v, want %+v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,481 @@
+package analysis
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"github.com/thecsw/katya/storage"
+	"github.com/thecsw/katya/utils"
+)
+
+const (
+	// boolMaxDistance caps the distance of NEAR/n
+	boolMaxDistance = 50
+	// boolMaxOccurrences caps the occurrences a single node of a boolean
+	// query keeps in a text, so frequent terms near each other don't explode
+	boolMaxOccurrences = 10000
+)
+
+var (
+	// boolLayers maps the term prefixes of boolean queries to the text layers
+	boolLayers = map[string]string{
+		"lemma": "lemmas",
+		"word":  "text",
+		"text":  "text",
+	}
+)
+
+// BoolQuery is a parsed boolean co-occurrence query, where terms are lemmas,
+// or words with a word: prefix, combined with AND, OR and NOT over the whole
+// text, or with NEAR/n and SENT, optionally negated with NOT, over the tokens,
+// like книга NEAR/5 полка NOT SENT стол
+type BoolQuery struct {
+	root boolNode
+}
+
+// BoolMatch is a single match of a boolean query in a text
+type BoolMatch struct {
+	// Span is the [start, end) token span of all the participating tokens
+	Span [2]int
+	// Positions are the offsets of the participating tokens
+	Positions []int
+}
+
+// boolText is a text a boolean query is matched against
+type boolText struct {
+	layers    map[string][]string
+	sentences []int
+}
+
+// boolNode is a node of a boolean query, its occurrences are the sorted
+// positions of the tokens that participate in every match
+type boolNode interface {
+	occurrences(text *boolText) [][]int
+}
+
+// boolTerm matches every token of the layer that is the same term, which
+// is compared as it's indexed, or only lowercased if it's strict
+type boolTerm struct {
+	layer  string
+	term   string
+	strict bool
+}
+
+// fold turns a token into what the term is compared with
+func (n boolTerm) fold(token string) string {
+	if n.strict {
+		return strings.ToLower(token)
+	}
+	return storage.IndexTerm(n.layer, token)
+}
+
+func (n boolTerm) occurrences(text *boolText) [][]int {
+	result := make([][]int, 0)
+	for i, token := range text.layers[n.layer] {
+		if n.fold(token) == n.term && len(result) < boolMaxOccurrences {
+			result = append(result, []int{i})
+		}
+	}
+	return result
+}
+
+// boolOr matches what either side matches
+type boolOr struct{ left, right boolNode }
+
+func (n boolOr) occurrences(text *boolText) [][]int {
+	return mergeOccurrences(n.left.occurrences(text), n.right.occurrences(text))
+}
+
+// boolAnd matches what both sides match if both match somewhere in the text
+type boolAnd struct{ left, right boolNode }
+
+func (n boolAnd) occurrences(text *boolText) [][]int {
+	left := n.left.occurrences(text)
+	if len(left) == 0 {
+		return left
+	}
+	right := n.right.occurrences(text)
+	if len(right) == 0 {
+		return right
+	}
+	return mergeOccurrences(left, right)
+}
+
+// boolNot matches what the left side matches if the right one matches nowhere
+type boolNot struct{ left, right boolNode }
+
+func (n boolNot) occurrences(text *boolText) [][]int {
+	left := n.left.occurrences(text)
+	if len(left) == 0 || len(n.right.occurrences(text)) > 0 {
+		return [][]int{}
+	}
+	return left
+}
+
+// boolNear joins the occurrences of both sides that are at most distance
+// tokens apart, or in the same sentence, negated it keeps the occurrences
+// of the left side that have no such occurrence of the right one
+type boolNear struct {
+	left, right boolNode
+	distance    int
+	sentence    bool
+	negated     bool
+}
+
+func (n boolNear) occurrences(text *boolText) [][]int {
+	result := make([][]int, 0)
+	left := n.left.occurrences(text)
+	if len(left) == 0 {
+		return result
+	}
+	// Sort the right side by where its occurrences start, so every left
+	// one only has to look through the window of those that can be close
+	right := n.right.occurrences(text)
+	sort.SliceStable(right, func(i, j int) bool { return right[i][0] < right[j][0] })
+	span := 0
+	for _, b := range right {
+		span = utils.Max(span, b[len(b)-1]-b[0])
+	}
+	seen := make(map[string]bool)
+	for _, a := range left {
+		found := false
+		lo, hi, ok := n.window(text, a, span)
+		from := sort.Search(len(right), func(i int) bool { return right[i][0] >= lo })
+		for i := from; ok && i < len(right) && right[i][0] <= hi; i++ {
+			b := right[i]
+			if !n.close(text, a, b) {
+				continue
+			}
+			found = true
+			if n.negated {
+				break
+			}
+			joined := joinPositions(a, b)
+			if key := occurrenceKey(joined); !seen[key] && len(result) < boolMaxOccurrences {
+				result = append(result, joined)
+				seen[key] = true
+			}
+		}
+		if n.negated && !found {
+			result = append(result, a)
+		}
+	}
+	return result
+}
+
+// window returns the [lo, hi] range the first positions of the right side
+// occurrences close to a have to be in, given their longest span,
+// ok is false if nothing can be close to a
+func (n boolNear) window(text *boolText, a []int, span int) (lo int, hi int, ok bool) {
+	first, last := a[0], a[len(a)-1]
+	if !n.sentence {
+		return first - n.distance - span, last + n.distance, true
+	}
+	if last >= len(text.sentences) || text.sentences[first] != text.sentences[last] {
+		return 0, 0, false
+	}
+	// Sentence numbers never go down, so a sentence is a run of them
+	sentence := text.sentences[first]
+	lo = sort.Search(len(text.sentences), func(i int) bool { return text.sentences[i] >= sentence })
+	hi = sort.Search(len(text.sentences), func(i int) bool { return text.sentences[i] > sentence }) - 1
+	return lo, hi, true
+}
+
+// close tells whether two occurrences are close enough to be joined
+func (n boolNear) close(text *boolText, a, b []int) bool {
+	first, last := a[0], a[len(a)-1]
+	if b[0] < first {
+		first = b[0]
+	}
+	if b[len(b)-1] > last {
+		last = b[len(b)-1]
+	}
+	if n.sentence {
+		return last < len(text.sentences) && text.sentences[first] == text.sentences[last]
+	}
+	// The gap between the closest ends, overlapping occurrences have none
+	gap := b[0] - a[len(a)-1]
+	if a[0] > b[len(b)-1] {
+		gap = a[0] - b[len(b)-1]
+	}
+	return gap <= n.distance
+}
+
+// joinPositions merges two sorted position lists without duplicates
+func joinPositions(a, b []int) []int {
+	joined := make([]int, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case j == len(b) || (i < len(a) && a[i] < b[j]):
+			joined = append(joined, a[i])
+			i++
+		case i == len(a) || b[j] < a[i]:
+			joined = append(joined, b[j])
+			j++
+		default:
+			joined = append(joined, a[i])
+			i, j = i+1, j+1
+		}
+	}
+	return joined
+}
+
+// mergeOccurrences puts the occurrences of both sides together without duplicates
+func mergeOccurrences(a, b [][]int) [][]int {
+	seen := make(map[string]bool, len(a))
+	result := make([][]int, 0, len(a)+len(b))
+	for _, v := range append(a, b...) {
+		if key := occurrenceKey(v); !seen[key] {
+			result = append(result, v)
+			seen[key] = true
+		}
+	}
+	return result
+}
+
+// occurrenceKey is a string we can tell the same occurrences apart by
+func occurrenceKey(positions []int) string {
+	key := strings.Builder{}
+	for _, v := range positions {
+		key.WriteString(strconv.Itoa(v))
+		key.WriteByte(' ')
+	}
+	return key.String()
+}
+
+// Match returns all the matches of the query in the given aligned layers,
+// where sentences are the sentence numbers of the tokens (see
+// storage.SentenceIDs), ordered by their spans, the same span only comes up once
+func (q *BoolQuery) Match(layers map[string][]string, sentences []int) []BoolMatch {
+	text := &boolText{layers: layers, sentences: sentences}
+	matches := make([]BoolMatch, 0)
+	seen := make(map[[2]int]bool)
+	for _, v := range q.root.occurrences(text) {
+		span := [2]int{v[0], v[len(v)-1] + 1}
+		if !seen[span] {
+			matches = append(matches, BoolMatch{Span: span, Positions: v})
+			seen[span] = true
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Span[0] != matches[j].Span[0] {
+			return matches[i].Span[0] < matches[j].Span[0]
+		}
+		return matches[i].Span[1] < matches[j].Span[1]
+	})
+	return matches
+}
+
+// Literal returns a layer and a term that every match of the query must
+// contain, so it can be looked up in the inverted index, ok is false if
+// there is no such term and all texts have to be checked
+func (q *BoolQuery) Literal() (layer string, term string, ok bool) {
+	return boolLiteral(q.root)
+}
+
+// boolLiteral finds a term that every match of the node must contain
+func boolLiteral(node boolNode) (string, string, bool) {
+	switch n := node.(type) {
+	case boolTerm:
+		// The index is always normalized, strict matches are a part of it
+		return n.layer, storage.IndexTerm(n.layer, n.term), true
+	case boolAnd:
+		return boolLiteral(n.left)
+	case boolNot:
+		return boolLiteral(n.left)
+	case boolNear:
+		return boolLiteral(n.left)
+	}
+	return "", "", false
+}
+
+// ParseBoolQuery parses a boolean query, OR binds the loosest, then AND and
+// NOT over the whole text, then NEAR/n, SENT, NOT NEAR/n and NOT SENT, all of
+// them are left associative and parentheses group them, strict terms are
+// only lowercased, so ё and е differ
+func ParseBoolQuery(query string, strict bool) (*BoolQuery, error) {
+	p := &boolParser{tokens: lexBoolQuery(query), strict: strict}
+	if len(p.tokens) == 0 {
+		return nil, errors.New("empty boolean query")
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, errors.Errorf("unexpected %q", p.peek())
+	}
+	return &BoolQuery{root: root}, nil
+}
+
+// lexBoolQuery splits a boolean query into words and parentheses
+func lexBoolQuery(query string) []string {
+	tokens := make([]string, 0, 8)
+	current := strings.Builder{}
+	flush := func() {
+		if current.Len() > 0 {
+			tokens = append(tokens, current.String())
+			current.Reset()
+		}
+	}
+	for _, r := range query {
+		switch {
+		case r == '(' || r == ')':
+			flush()
+			tokens = append(tokens, string(r))
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+// boolParser is a small recursive descent parser of boolean queries
+type boolParser struct {
+	tokens []string
+	pos    int
+	strict bool
+}
+
+func (p *boolParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *boolParser) peek() string {
+	if p.done() {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+// proximity tells whether the token is NEAR/n or SENT and parses it
+func (p *boolParser) proximity(token string) (distance int, sentence bool, ok bool, err error) {
+	if token == "SENT" {
+		return 0, true, true, nil
+	}
+	if !strings.HasPrefix(token, "NEAR/") {
+		return 0, false, false, nil
+	}
+	distance, err = strconv.Atoi(strings.TrimPrefix(token, "NEAR/"))
+	if err != nil || distance < 1 || distance > boolMaxDistance {
+		return 0, false, false, errors.Errorf("NEAR distance must be within 1..%d", boolMaxDistance)
+	}
+	return distance, false, true, nil
+}
+
+// parseOr parses terms separated by OR
+func (p *boolParser) parseOr() (boolNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "OR" {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = boolOr{left, right}
+	}
+	return left, nil
+}
+
+// parseAnd parses terms separated by AND or NOT
+func (p *boolParser) parseAnd() (boolNode, error) {
+	left, err := p.parseProximity()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "AND" || p.peek() == "NOT" {
+		operator := p.peek()
+		p.pos++
+		right, err := p.parseProximity()
+		if err != nil {
+			return nil, err
+		}
+		if operator == "AND" {
+			left = boolAnd{left, right}
+		} else {
+			left = boolNot{left, right}
+		}
+	}
+	return left, nil
+}
+
+// parseProximity parses terms separated by NEAR/n or SENT, which can be
+// negated by a NOT right in front of them
+func (p *boolParser) parseProximity() (boolNode, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		negated, operator := false, p.peek()
+		if operator == "NOT" && p.pos+1 < len(p.tokens) {
+			negated, operator = true, p.tokens[p.pos+1]
+		}
+		distance, sentence, ok, err := p.proximity(operator)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return left, nil
+		}
+		p.pos++
+		if negated {
+			p.pos++
+		}
+		right, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		left = boolNear{left: left, right: right, distance: distance, sentence: sentence, negated: negated}
+	}
+}
+
+// parsePrimary parses a parenthesized query or a single term
+func (p *boolParser) parsePrimary() (boolNode, error) {
+	token := p.peek()
+	switch token {
+	case "":
+		return nil, errors.New("unexpected end of the boolean query")
+	case "(":
+		p.pos++
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, errors.New("unclosed parenthesis")
+		}
+		p.pos++
+		return node, nil
+	case ")", "AND", "OR", "NOT", "SENT":
+		return nil, errors.Errorf("unexpected %q", token)
+	}
+	if strings.HasPrefix(token, "NEAR/") {
+		return nil, errors.Errorf("unexpected %q", token)
+	}
+	p.pos++
+	layer, value := "lemmas", token
+	if i := strings.IndexByte(token, ':'); i > 0 {
+		prefixed, ok := boolLayers[strings.ToLower(token[:i])]
+		if !ok {
+			return nil, errors.Errorf("unknown layer of %q", token)
+		}
+		layer, value = prefixed, token[i+1:]
+	}
+	if value == "" {
+		return nil, errors.Errorf("empty term %q", token)
+	}
+	term := boolTerm{layer: layer, strict: p.strict}
+	term.term = term.fold(value)
+	return term, nil
+}
@@ -0,0 +1,75 @@
+package analysis
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/thecsw/katya/storage"
+)
+
+func TestBoolQuery_Match(t *testing.T) {
+	layers := map[string][]string{
+		"text":   strings.Split("Книга лежит на полке . На столе лежит другая книга , а полка пуста . Всё .", " "),
+		"lemmas": strings.Split("книга лежать на полка . на стол лежать другой книга , а полка пустой . всё .", " "),
+	}
+	tests := []struct {
+		name   string
+		query  string
+		strict bool
+		want   []BoolMatch
+	}{
+		{"term", "книга", false, []BoolMatch{{[2]int{0, 1}, []int{0}}, {[2]int{9, 10}, []int{9}}}},
+		{"word", "word:полке", false, []BoolMatch{{[2]int{3, 4}, []int{3}}}},
+		{"near", "книга NEAR/3 полка", false, []BoolMatch{{[2]int{0, 4}, []int{0, 3}}, {[2]int{9, 13}, []int{9, 12}}}},
+		{"near before", "полка NEAR/3 книга", false, []BoolMatch{{[2]int{0, 4}, []int{0, 3}}, {[2]int{9, 13}, []int{9, 12}}}},
+		{"too far", "книга NEAR/2 полка", false, []BoolMatch{}},
+		{"same sentence", "книга SENT стол", false, []BoolMatch{{[2]int{6, 10}, []int{6, 9}}}},
+		{"not in sentence", "книга NEAR/3 полка NOT SENT стол", false, []BoolMatch{{[2]int{0, 4}, []int{0, 3}}}},
+		{"or", "стол OR пустой", false, []BoolMatch{{[2]int{6, 7}, []int{6}}, {[2]int{13, 14}, []int{13}}}},
+		{"and", "стол AND пустой", false, []BoolMatch{{[2]int{6, 7}, []int{6}}, {[2]int{13, 14}, []int{13}}}},
+		{"and missing", "стол AND шкаф", false, []BoolMatch{}},
+		{"not", "стол NOT шкаф", false, []BoolMatch{{[2]int{6, 7}, []int{6}}}},
+		{"not present", "стол NOT полка", false, []BoolMatch{}},
+		{"grouped", "(стол OR полка) SENT другой", false, []BoolMatch{{[2]int{6, 9}, []int{6, 8}}, {[2]int{8, 13}, []int{8, 12}}}},
+		{"normalized", "word:все", false, []BoolMatch{{[2]int{15, 16}, []int{15}}}},
+		{"strict", "word:все", true, []BoolMatch{}},
+		{"strict exact", "word:всё", true, []BoolMatch{{[2]int{15, 16}, []int{15}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := ParseBoolQuery(tt.query, tt.strict)
+			if err != nil {
+				t.Fatalf("ParseBoolQuery() error = %v", err)
+			}
+			sentences := storage.SentenceIDs(&storage.Text{}, layers["text"])
+			if got := q.Match(layers, sentences); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseBoolQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		wantErr bool
+	}{
+		{"empty", ``, true},
+		{"dangling operator", `книга AND`, true},
+		{"leading operator", `OR книга`, true},
+		{"unclosed", `(книга OR полка`, true},
+		{"bad distance", `книга NEAR/0 полка`, true},
+		{"far distance", `книга NEAR/100 полка`, true},
+		{"unknown layer", `tag:NOUN`, true},
+		{"nested", `(книга NEAR/5 полка) NOT SENT (стол OR шкаф)`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseBoolQuery(tt.query, false); (err != nil) != tt.wantErr {
+				t.Errorf("ParseBoolQuery() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
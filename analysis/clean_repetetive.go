@@ -3,6 +3,7 @@ package analysis
 import (
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"sync"
 	"unicode"
@@ -40,6 +41,7 @@ func CleanTexts(texts []storage.Text) ([]storage.Text, int, error) {
 			lemmasNew, _ := removeIndices(lemmas, st.Right)
 
 			textsLock.Lock()
+			texts[i].Sentences = remapSentences(texts[i].Sentences, text, st.Right)
 			texts[i].Text = strings.Join(textNew, " ")
 			texts[i].Shapes = strings.Join(shapesNew, " ")
 			texts[i].Tags = strings.Join(tagsNew, " ")
@@ -59,7 +61,9 @@ func CleanTexts(texts []storage.Text) ([]storage.Text, int, error) {
 	wg.Wait()
 	// Update the final pivot text
 	fmt.Println("Finally updating the pivot")
-	textNew, deleted := removeIndices(strings.Split(texts[0].Text, " "), stt.Right)
+	pivotText := strings.Split(texts[0].Text, " ")
+	texts[0].Sentences = remapSentences(texts[0].Sentences, pivotText, stt.Right)
+	textNew, deleted := removeIndices(pivotText, stt.Right)
 	shapesNew, _ := removeIndices(strings.Split(texts[0].Shapes, " "), stt.Right)
 	tagsNew, _ := removeIndices(strings.Split(texts[0].Tags, " "), stt.Right)
 	lemmasNew, _ := removeIndices(strings.Split(texts[0].Lemmas, " "), stt.Right)
@@ -74,9 +78,24 @@ func CleanTexts(texts []storage.Text) ([]storage.Text, int, error) {
 }
 
 func removeIndices(texts []string, indices []int) ([]string, int) {
-	indicesPointer := 0
+	kept := keptIndices(texts, indices)
 	actuallyRemoved := 0
 	toReturn := make([]string, 0, len(texts)-len(indices))
+	for i, v := range texts {
+		if kept[i] {
+			toReturn = append(toReturn, v)
+		} else if len(v) > 0 {
+			actuallyRemoved++
+		}
+	}
+	return toReturn, actuallyRemoved
+}
+
+// keptIndices tells which tokens removeIndices keeps, which are the non-empty
+// ones that are either not in the sorted indices or are punctuation
+func keptIndices(texts []string, indices []int) []bool {
+	indicesPointer := 0
+	kept := make([]bool, len(texts))
 	for i, v := range texts {
 		// Sanity check
 		if len(v) == 0 {
@@ -85,17 +104,47 @@ func removeIndices(texts []string, indices []int) ([]string, int) {
 		// see if it's a bad symbol
 		isTooCommon := unicodeIsThis(v, unicode.IsPunct)
 		// Check that it's not a stopword or a punct
-		if i == indices[indicesPointer] {
+		if indicesPointer < len(indices) && i == indices[indicesPointer] {
 			indicesPointer++
 			// If it's a symbol that's too common (period), add it
 			if !isTooCommon {
-				actuallyRemoved++
 				continue
 			}
 		}
-		toReturn = append(toReturn, v)
+		kept[i] = true
 	}
-	return toReturn, actuallyRemoved
+	return kept
+}
+
+// remapSentences moves the sentence starts of a text (see storage.Text) to
+// where their tokens are after removeIndices, a sentence that starts with a
+// removed token starts with its next kept one, emptied sentences are gone
+func remapSentences(sentences string, texts []string, indices []int) string {
+	if sentences == "" {
+		return ""
+	}
+	kept := keptIndices(texts, indices)
+	// shifted[i] is where the i-th token, or the next kept one, ends up
+	shifted := make([]int, len(texts)+1)
+	for i := range texts {
+		shifted[i+1] = shifted[i]
+		if kept[i] {
+			shifted[i+1]++
+		}
+	}
+	remapped := make([]string, 0, 16)
+	last := -1
+	for _, field := range strings.Fields(sentences) {
+		start, err := strconv.Atoi(field)
+		if err != nil || start < 0 || start >= len(texts) {
+			continue
+		}
+		if moved := shifted[start]; moved > last && moved < shifted[len(texts)] {
+			remapped = append(remapped, strconv.Itoa(moved))
+			last = moved
+		}
+	}
+	return strings.Join(remapped, " ")
 }
 
 func getIndices(texts []string, indices []int) []string {
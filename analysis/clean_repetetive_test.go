@@ -0,0 +1,29 @@
+package analysis
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_remapSentences(t *testing.T) {
+	tokens := strings.Split("Меню сайта . Я читаю . Книга лежит .", " ")
+	tests := []struct {
+		name      string
+		sentences string
+		indices   []int
+		want      string
+	}{
+		{"nothing removed", "0 3 6", []int{}, "0 3 6"},
+		{"sentence emptied", "0 3 6", []int{0, 1}, "0 1 4"},
+		{"first token removed", "0 3 6", []int{3}, "0 3 5"},
+		{"trailing removed", "0 3 6", []int{6, 7}, "0 3 6"},
+		{"no sentences", "", []int{0}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := remapSentences(tt.sentences, tokens, tt.indices); got != tt.want {
+				t.Errorf("remapSentences() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package analysis
+
+import (
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// MaxContextTokens is the widest context in tokens one can ask for
+	MaxContextTokens = 200
+	// MaxContextChars is the widest context in characters one can ask for
+	MaxContextChars = 2000
+	// DefaultContextChars is the context width when it's asked in characters
+	// without a width
+	DefaultContextChars = 200
+)
+
+// ContextWidth is how much context is cut on each side of a hit
+type ContextWidth struct {
+	// Left is the width of the left context
+	Left int
+	// Right is the width of the right context
+	Right int
+	// Chars tells whether the widths are in characters, contexts still only
+	// have whole tokens, so they stay aligned with the annotation layers
+	Chars bool
+}
+
+// Validate checks that the widths are within the ceilings
+func (c ContextWidth) Validate() error {
+	max := MaxContextTokens
+	if c.Chars {
+		max = MaxContextChars
+	}
+	if c.Left < 0 || c.Left > max || c.Right < 0 || c.Right > max {
+		return errors.Errorf("context width has to be between 0 and %d", max)
+	}
+	return nil
+}
+
+// Bounds returns the [left, right) token bounds of the context around the
+// [start, end) span of the tokens
+func (c ContextWidth) Bounds(tokens []string, start, end int) (int, int) {
+	if !c.Chars {
+		left := start - c.Left
+		if left < 0 {
+			left = 0
+		}
+		right := end + c.Right
+		if right > len(tokens) {
+			right = len(tokens)
+		}
+		return left, right
+	}
+	// Every token takes its characters and the space that separates it
+	left, width := start, 0
+	for left > 0 {
+		width += utf8.RuneCountInString(tokens[left-1]) + 1
+		if width > c.Left {
+			break
+		}
+		left--
+	}
+	right, width := end, 0
+	for right < len(tokens) {
+		width += utf8.RuneCountInString(tokens[right]) + 1
+		if width > c.Right {
+			break
+		}
+		right++
+	}
+	return left, right
+}
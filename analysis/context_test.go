@@ -0,0 +1,33 @@
+package analysis
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestContextWidth_Bounds(t *testing.T) {
+	tokens := strings.Split("Я люблю новую книгу и старую книгу .", " ")
+	tests := []struct {
+		name      string
+		width     ContextWidth
+		start     int
+		end       int
+		wantLeft  int
+		wantRight int
+	}{
+		{"tokens", ContextWidth{Left: 2, Right: 2}, 3, 4, 1, 6},
+		{"asymmetric", ContextWidth{Left: 0, Right: 1}, 3, 4, 3, 5},
+		{"clamped", ContextWidth{Left: 10, Right: 10}, 3, 4, 0, 8},
+		{"chars", ContextWidth{Left: 11, Right: 9, Chars: true}, 3, 4, 2, 6},
+		{"chars too narrow", ContextWidth{Left: 3, Right: 1, Chars: true}, 3, 4, 3, 4},
+		{"chars clamped", ContextWidth{Left: 100, Right: 100, Chars: true}, 3, 4, 0, 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			left, right := tt.width.Bounds(tokens, tt.start, tt.end)
+			if left != tt.wantLeft || right != tt.wantRight {
+				t.Errorf("Bounds() = %v, %v, want %v, %v", left, right, tt.wantLeft, tt.wantRight)
+			}
+		})
+	}
+}
@@ -0,0 +1,448 @@
+package analysis
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// cqlMaxRepeat caps the unbounded quantifiers (* and +) so a
+	// single token position can't swallow the whole text
+	cqlMaxRepeat = 10
+	// cqlMaxWildcards caps how many repeated [] tokens a query can have,
+	// every one of them multiplies the ways a text can be matched
+	cqlMaxWildcards = 3
+	// cqlUnknown marks the positions matchFrom hasn't tried yet
+	cqlUnknown = -2
+)
+
+var (
+	// cqlAttributes maps CQL attribute names to the text layers they query
+	cqlAttributes = map[string]string{
+		"word":   "text",
+		"text":   "text",
+		"lemma":  "lemmas",
+		"tag":    "tags",
+		"pos":    "tags",
+		"shape":  "shapes",
+		"shapes": "shapes",
+	}
+)
+
+// CQLQuery is a parsed corpus query, which is a sequence of token
+// positions, where every position can constrain multiple layers, like
+// [lemma="любить" & tag="VERB"] [tag="ADJ"]? [tag="NOUN"]
+type CQLQuery struct {
+	tokens []cqlToken
+}
+
+// cqlToken is a single token position with its repetition bounds
+type cqlToken struct {
+	cond cqlCondition
+	min  int
+	max  int
+}
+
+// cqlCondition is a boolean condition evaluated against a single token
+type cqlCondition interface {
+	eval(layers map[string][]string, i int) bool
+}
+
+// cqlAny matches any token, it's the [] token
+type cqlAny struct{}
+
+func (cqlAny) eval(map[string][]string, int) bool { return true }
+
+// cqlAttr compares a layer of the token against an anchored regexp
+type cqlAttr struct {
+	layer   string
+	raw     string
+	value   *regexp.Regexp
+	negated bool
+}
+
+func (c cqlAttr) eval(layers map[string][]string, i int) bool {
+	tokens := layers[c.layer]
+	if i >= len(tokens) {
+		return false
+	}
+	return c.value.MatchString(tokens[i]) != c.negated
+}
+
+// cqlNot negates a condition
+type cqlNot struct{ cond cqlCondition }
+
+func (c cqlNot) eval(layers map[string][]string, i int) bool { return !c.cond.eval(layers, i) }
+
+// cqlAnd is a conjunction of conditions
+type cqlAnd []cqlCondition
+
+func (c cqlAnd) eval(layers map[string][]string, i int) bool {
+	for _, v := range c {
+		if !v.eval(layers, i) {
+			return false
+		}
+	}
+	return true
+}
+
+// cqlOr is a disjunction of conditions
+type cqlOr []cqlCondition
+
+func (c cqlOr) eval(layers map[string][]string, i int) bool {
+	for _, v := range c {
+		if v.eval(layers, i) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseCQL parses a CQL query, values are regular expressions that have to
+// match the whole token, a bare "value" is a shortcut for [word="value"]
+func ParseCQL(query string, caseSensitive bool) (*CQLQuery, error) {
+	p := &cqlParser{input: query, caseSensitive: caseSensitive}
+	result := &CQLQuery{tokens: make([]cqlToken, 0, 4)}
+	for {
+		p.skipSpaces()
+		if p.done() {
+			break
+		}
+		token, err := p.parseToken()
+		if err != nil {
+			return nil, err
+		}
+		result.tokens = append(result.tokens, token)
+	}
+	if len(result.tokens) == 0 {
+		return nil, errors.New("empty cql query")
+	}
+	wildcards := 0
+	for _, token := range result.tokens {
+		if _, isAny := token.cond.(cqlAny); isAny && token.max > token.min {
+			wildcards++
+		}
+	}
+	if wildcards > cqlMaxWildcards {
+		return nil, errors.Errorf("cql query can have at most %d repeated [] tokens", cqlMaxWildcards)
+	}
+	return result, nil
+}
+
+// Literal returns a layer and a plain value that every match of the query
+// must contain, so it can be used to narrow down texts in the database,
+// ok is false if there is no such value and all texts have to be checked
+func (q *CQLQuery) Literal() (layer string, value string, ok bool) {
+	for _, token := range q.tokens {
+		if token.min < 1 {
+			continue
+		}
+		conds := []cqlCondition{token.cond}
+		if and, isAnd := token.cond.(cqlAnd); isAnd {
+			conds = and
+		}
+		for _, cond := range conds {
+			attr, isAttr := cond.(cqlAttr)
+			if !isAttr || attr.negated {
+				continue
+			}
+			if attr.raw != "" && regexp.QuoteMeta(attr.raw) == attr.raw {
+				return attr.layer, attr.raw, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// Match returns all non-overlapping [start, end) token spans that match the
+// query in the given aligned layers, longer matches are preferred
+func (q *CQLQuery) Match(layers map[string][]string) [][2]int {
+	matches := make([][2]int, 0)
+	numTokens := len(layers["text"])
+	// Where tokens[which:] matching from the i-th token ends, shared by
+	// all the starts, so backtracking never tries the same thing twice
+	memo := make([]int, len(q.tokens)*(numTokens+1))
+	for i := range memo {
+		memo[i] = cqlUnknown
+	}
+	for start := 0; start < numTokens; {
+		end := q.matchFrom(layers, numTokens, memo, 0, start)
+		if end > start {
+			matches = append(matches, [2]int{start, end})
+			start = end
+			continue
+		}
+		start++
+	}
+	return matches
+}
+
+// matchFrom tries to match tokens[which:] starting from the i-th token,
+// returning the end of the match or -1 if it doesn't match
+func (q *CQLQuery) matchFrom(layers map[string][]string, numTokens int, memo []int, which, i int) int {
+	if which == len(q.tokens) {
+		return i
+	}
+	key := which*(numTokens+1) + i
+	if memo[key] != cqlUnknown {
+		return memo[key]
+	}
+	memo[key] = q.matchToken(layers, numTokens, memo, which, i)
+	return memo[key]
+}
+
+// matchToken matches the which-th token from the i-th token and the rest after it
+func (q *CQLQuery) matchToken(layers map[string][]string, numTokens int, memo []int, which, i int) int {
+	token := q.tokens[which]
+	// Greedily consume as many tokens as possible and backtrack
+	consumed := 0
+	for consumed < token.max && i+consumed < numTokens && token.cond.eval(layers, i+consumed) {
+		consumed++
+	}
+	for ; consumed >= token.min; consumed-- {
+		if end := q.matchFrom(layers, numTokens, memo, which+1, i+consumed); end >= 0 {
+			return end
+		}
+	}
+	return -1
+}
+
+// cqlParser is a small recursive descent parser of CQL queries
+type cqlParser struct {
+	input         string
+	pos           int
+	caseSensitive bool
+}
+
+func (p *cqlParser) done() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *cqlParser) peek() byte {
+	if p.done() {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *cqlParser) skipSpaces() {
+	for !p.done() {
+		r, size := utf8.DecodeRuneInString(p.input[p.pos:])
+		if !unicode.IsSpace(r) {
+			return
+		}
+		p.pos += size
+	}
+}
+
+func (p *cqlParser) expect(what byte) error {
+	p.skipSpaces()
+	if p.peek() != what {
+		return errors.Errorf("expected %q at position %d", what, p.pos)
+	}
+	p.pos++
+	return nil
+}
+
+// parseToken parses a single token position with its quantifier
+func (p *cqlParser) parseToken() (cqlToken, error) {
+	token := cqlToken{min: 1, max: 1}
+	switch p.peek() {
+	case '"':
+		raw, value, err := p.parseValue("text")
+		if err != nil {
+			return token, err
+		}
+		token.cond = cqlAttr{layer: "text", raw: raw, value: value}
+	case '[':
+		p.pos++
+		p.skipSpaces()
+		if p.peek() == ']' {
+			p.pos++
+			token.cond = cqlAny{}
+			break
+		}
+		cond, err := p.parseOr()
+		if err != nil {
+			return token, err
+		}
+		if err := p.expect(']'); err != nil {
+			return token, err
+		}
+		token.cond = cond
+	default:
+		return token, errors.Errorf("expected a token at position %d", p.pos)
+	}
+	return token, p.parseQuantifier(&token)
+}
+
+// parseQuantifier parses an optional ?, *, + or {n,m} after a token
+func (p *cqlParser) parseQuantifier(token *cqlToken) error {
+	switch p.peek() {
+	case '?':
+		token.min, token.max = 0, 1
+	case '*':
+		token.min, token.max = 0, cqlMaxRepeat
+	case '+':
+		token.min, token.max = 1, cqlMaxRepeat
+	case '{':
+		closing := strings.IndexByte(p.input[p.pos:], '}')
+		if closing < 0 {
+			return errors.Errorf("unclosed repetition at position %d", p.pos)
+		}
+		bounds := strings.Split(p.input[p.pos+1:p.pos+closing], ",")
+		if len(bounds) > 2 {
+			return errors.Errorf("bad repetition at position %d", p.pos)
+		}
+		min, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		if err != nil {
+			return errors.Errorf("bad repetition at position %d", p.pos)
+		}
+		max := min
+		if len(bounds) == 2 {
+			max = cqlMaxRepeat
+			if upper := strings.TrimSpace(bounds[1]); upper != "" {
+				if max, err = strconv.Atoi(upper); err != nil {
+					return errors.Errorf("bad repetition at position %d", p.pos)
+				}
+			}
+		}
+		if min < 0 || max < min || max > cqlMaxRepeat {
+			return errors.Errorf("repetition at position %d must be within 0..%d", p.pos, cqlMaxRepeat)
+		}
+		token.min, token.max = min, max
+		p.pos += closing
+	default:
+		return nil
+	}
+	p.pos++
+	return nil
+}
+
+// parseOr parses conditions separated by |
+func (p *cqlParser) parseOr() (cqlCondition, error) {
+	first, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	conds := cqlOr{first}
+	for p.skipSpaces(); p.peek() == '|'; p.skipSpaces() {
+		p.pos++
+		next, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, next)
+	}
+	if len(conds) == 1 {
+		return first, nil
+	}
+	return conds, nil
+}
+
+// parseAnd parses conditions separated by &
+func (p *cqlParser) parseAnd() (cqlCondition, error) {
+	first, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	conds := cqlAnd{first}
+	for p.skipSpaces(); p.peek() == '&'; p.skipSpaces() {
+		p.pos++
+		next, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, next)
+	}
+	if len(conds) == 1 {
+		return first, nil
+	}
+	return conds, nil
+}
+
+// parseUnary parses a negation, a parenthesized group or an attribute test
+func (p *cqlParser) parseUnary() (cqlCondition, error) {
+	p.skipSpaces()
+	switch p.peek() {
+	case '!':
+		p.pos++
+		cond, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return cqlNot{cond}, nil
+	case '(':
+		p.pos++
+		cond, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return cond, p.expect(')')
+	}
+	// Read the attribute name
+	start := p.pos
+	for !p.done() && (unicode.IsLetter(rune(p.peek())) || p.peek() == '_') {
+		p.pos++
+	}
+	name := strings.ToLower(p.input[start:p.pos])
+	layer, ok := cqlAttributes[name]
+	if !ok {
+		return nil, errors.Errorf("unknown attribute %q at position %d", name, start)
+	}
+	// Read the comparison operator
+	p.skipSpaces()
+	negated := false
+	if p.peek() == '!' {
+		negated = true
+		p.pos++
+	}
+	if err := p.expect('='); err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	raw, value, err := p.parseValue(layer)
+	if err != nil {
+		return nil, err
+	}
+	return cqlAttr{layer: layer, raw: raw, value: value, negated: negated}, nil
+}
+
+// parseValue parses a double-quoted value into an anchored regexp
+func (p *cqlParser) parseValue(layer string) (string, *regexp.Regexp, error) {
+	if err := p.expect('"'); err != nil {
+		return "", nil, err
+	}
+	value := strings.Builder{}
+	for {
+		if p.done() {
+			return "", nil, errors.New("unclosed value in cql query")
+		}
+		c := p.input[p.pos]
+		p.pos++
+		if c == '"' {
+			break
+		}
+		// Only unescape quotes, the rest is passed to regexp as is
+		if c == '\\' && p.peek() == '"' {
+			c = '"'
+			p.pos++
+		}
+		value.WriteByte(c)
+	}
+	flags := ""
+	// Shapes are case sensitive by their nature, X and x mean different things
+	if !p.caseSensitive && layer != "shapes" {
+		flags = "(?i)"
+	}
+	compiled, err := regexp.Compile(flags + "^(?:" + value.String() + ")$")
+	if err != nil {
+		return "", nil, errors.Wrap(err, "bad value in cql query")
+	}
+	return value.String(), compiled, nil
+}
@@ -0,0 +1,110 @@
+package analysis
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCQLQuery_Match(t *testing.T) {
+	layers := map[string][]string{
+		"text":   strings.Split("Я люблю новую книгу и старую книгу .", " "),
+		"lemmas": strings.Split("я любить новый книга и старый книга .", " "),
+		"tags":   strings.Split("PRON VERB ADJ NOUN CCONJ ADJ NOUN PUNCT", " "),
+		"shapes": strings.Split("X xxxx xxxx xxxx x xxxx xxxx .", " "),
+	}
+	tests := []struct {
+		name  string
+		query string
+		want  [][2]int
+	}{
+		{"bare word", `"книгу"`, [][2]int{{3, 4}, {6, 7}}},
+		{"case insensitive", `"я"`, [][2]int{{0, 1}}},
+		{"multiple layers", `[lemma="любить" & tag="VERB"] [tag="ADJ"]? [tag="NOUN"]`, [][2]int{{1, 4}}},
+		{"optional skipped", `[tag="CCONJ"] [tag="ADJ"]? [tag="NOUN"]`, [][2]int{{4, 7}}},
+		{"repetition", `[tag="ADJ" | tag="NOUN"]{2,3}`, [][2]int{{2, 4}, {5, 7}}},
+		{"negation", `[tag="NOUN"] [tag!="CCONJ"]`, [][2]int{{6, 8}}},
+		{"negated group", `[!(tag="NOUN" | tag="ADJ") & shape="xxxx"]`, [][2]int{{1, 2}}},
+		{"any token", `[lemma="новый"] [] [lemma="и"]`, [][2]int{{2, 5}}},
+		{"regexp value", `[lemma="ст.*"]`, [][2]int{{5, 6}}},
+		{"no match", `[tag="DET"]`, [][2]int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := ParseCQL(tt.query, false)
+			if err != nil {
+				t.Fatalf("ParseCQL() error = %v", err)
+			}
+			if got := q.Match(layers); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCQLQuery_MatchWildcards(t *testing.T) {
+	// Without memoization this backtracks through 10^3 ways at every token
+	tokens := strings.Split(strings.Repeat("а ", 5000), " ")
+	layers := map[string][]string{"text": tokens[:len(tokens)-1]}
+	q, err := ParseCQL(`[]* []* []* "zzz"`, false)
+	if err != nil {
+		t.Fatalf("ParseCQL() error = %v", err)
+	}
+	if got := q.Match(layers); len(got) != 0 {
+		t.Errorf("Match() = %v, want no matches", got)
+	}
+}
+
+func TestParseCQL(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		wantErr bool
+	}{
+		{"empty", ``, true},
+		{"unknown attribute", `[color="red"]`, true},
+		{"unclosed token", `[tag="NOUN"`, true},
+		{"unclosed value", `[tag="NOUN]`, true},
+		{"bad repetition", `[tag="NOUN"]{3,1}`, true},
+		{"too much repetition", `[]{1,100}`, true},
+		{"open repetition", `[tag="ADJ"]{1,} [tag="NOUN"]`, false},
+		{"escaped quote", `[word="\""]`, false},
+		{"wildcards", `[]* []+ []{0,5} "zzz"`, false},
+		{"too many wildcards", `[]* []* []* []* "zzz"`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseCQL(tt.query, false); (err != nil) != tt.wantErr {
+				t.Errorf("ParseCQL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCQLQuery_Literal(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		wantLayer string
+		wantValue string
+		wantOk    bool
+	}{
+		{"first required", `[tag="ADJ"]? [lemma="книга" & tag="NOUN"]`, "lemmas", "книга", true},
+		{"skips regexps", `[lemma="кни.*"] [tag="NOUN"]`, "tags", "NOUN", true},
+		{"skips negations", `[tag!="NOUN"]`, "", "", false},
+		{"any token", `[]`, "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := ParseCQL(tt.query, false)
+			if err != nil {
+				t.Fatalf("ParseCQL() error = %v", err)
+			}
+			layer, value, ok := q.Literal()
+			if layer != tt.wantLayer || value != tt.wantValue || ok != tt.wantOk {
+				t.Errorf("Literal() = %v, %v, %v, want %v, %v, %v",
+					layer, value, ok, tt.wantLayer, tt.wantValue, tt.wantOk)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"github.com/thecsw/katya/storage"
+)
+
+// WordDistribution is the frequency of a word with its spread over the texts
+type WordDistribution struct {
+	// Word is the counted word, see FrequencyOptions
+	Word string
+	// Hits is the number of times the word occurs
+	Hits uint
+	// Texts is the number of texts the word occurs in
+	Texts uint
+	// IPM is the number of hits per million words
+	IPM float64
+	// JuillandD is Juilland's D over the texts, 1 is a perfectly even spread
+	JuillandD float64
+	// GriesDP is Gries' deviation of proportions, 0 is a perfectly even spread
+	GriesDP float64
+}
+
+// wordOccurrence is the number of hits of a word in a text of the given size
+type wordOccurrence struct {
+	hits uint
+	size uint
+}
+
+// FindWordDistributions counts the words of the scope's texts, treating
+// every text as a corpus part for the dispersions, ipm is relative to
+// numWords, or to the number of words of the counted texts if it's 0
+func FindWordDistributions(scope storage.Scope, numWords uint, options FrequencyOptions) ([]WordDistribution, error) {
+	occurrences := make(map[string][]wordOccurrence)
+	numTexts, numTokens, textsWords := 0, uint(0), uint(0)
+	err := storage.WalkScopedTexts(scope, frequencyBatchSize, func(texts []storage.Text) error {
+		for _, text := range texts {
+			counts := make(map[string]uint)
+			keys, size := frequencyKeys(&text, options)
+			for _, key := range keys {
+				if key != "" {
+					counts[key]++
+				}
+			}
+			if size == 0 {
+				continue
+			}
+			for word, hits := range counts {
+				occurrences[word] = append(occurrences[word], wordOccurrence{hits: hits, size: size})
+			}
+			numTexts++
+			numTokens += size
+			textsWords += text.NumWords
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't retrieve scope texts")
+	}
+	if numWords == 0 {
+		numWords = textsWords
+	}
+	distributions := make([]WordDistribution, 0, len(occurrences))
+	for word, v := range occurrences {
+		distributions = append(distributions, wordDistribution(word, v, numTexts, numTokens, numWords))
+	}
+	return distributions, nil
+}
+
+// wordDistribution computes the frequency and the dispersions of a word out
+// of its occurrences in the texts, where numTexts and numTokens describe all
+// the texts, including the ones the word doesn't occur in
+func wordDistribution(word string, occurrences []wordOccurrence, numTexts int, numTokens, numWords uint) WordDistribution {
+	result := WordDistribution{Word: word, Texts: uint(len(occurrences))}
+	for _, v := range occurrences {
+		result.Hits += v.hits
+	}
+	if numWords > 0 {
+		result.IPM = float64(result.Hits) / float64(numWords) * 1e6
+	}
+
+	// Gries' DP compares the share of hits in every text with the text's share of the
+	// corpus, the texts without hits add their whole share, which sums up to what's
+	// left of the corpus after the texts with hits
+	deviation, covered := 0.0, 0.0
+	// Juilland's D takes the variation of the relative frequencies in the texts
+	sum, sumSquares := 0.0, 0.0
+	for _, v := range occurrences {
+		share := float64(v.size) / float64(numTokens)
+		deviation += math.Abs(float64(v.hits)/float64(result.Hits) - share)
+		covered += share
+		relative := float64(v.hits) / float64(v.size)
+		sum += relative
+		sumSquares += relative * relative
+	}
+	result.GriesDP = (deviation + math.Max(0, 1-covered)) / 2
+
+	// A single text can't show any variation
+	result.JuillandD = 1
+	if numTexts > 1 && sum > 0 {
+		n := float64(numTexts)
+		mean := sum / n
+		sd := math.Sqrt(math.Max(0, sumSquares/n-mean*mean))
+		result.JuillandD = 1 - sd/mean/math.Sqrt(n-1)
+	}
+	return result
+}
+
+// FilterDistributions drops stopwords, punctuation and the words with fewer
+// than minFreq hits, just like FilterStopwordsSimple, and sorts the rest
+// from the most frequent word
+func FilterDistributions(distributions []WordDistribution, stoplist map[string]bool, minFreq uint) []WordDistribution {
+	filtered := make([]WordDistribution, 0, len(distributions))
+	for _, v := range distributions {
+		word := frequencyKeyWord(v.Word)
+		if _, isStopword := stoplist[strings.ToLower(word)]; isStopword || v.Hits < minFreq {
+			continue
+		}
+		if unicodeIsThis(word, unicode.IsPunct) || unicodeIsThis(word, unicode.IsSymbol) {
+			continue
+		}
+		filtered = append(filtered, v)
+	}
+	sort.Slice(filtered, func(i, j int) bool {
+		if filtered[i].Hits != filtered[j].Hits {
+			return filtered[i].Hits > filtered[j].Hits
+		}
+		return filtered[i].Word < filtered[j].Word
+	})
+	return filtered
+}
+
+// DistributionRows turns the distributions into rows of the word, hits,
+// texts, ipm, Juilland's D and Gries' DP, the first two are what
+// FilterStopwordsSimple returns
+func DistributionRows(distributions []WordDistribution) [][]string {
+	toWrite := make([][]string, 0, len(distributions))
+	for _, v := range distributions {
+		toWrite = append(toWrite, []string{
+			v.Word,
+			strconv.FormatUint(uint64(v.Hits), 10),
+			strconv.FormatUint(uint64(v.Texts), 10),
+			strconv.FormatFloat(v.IPM, 'f', 2, 64),
+			strconv.FormatFloat(v.JuillandD, 'f', 4, 64),
+			strconv.FormatFloat(v.GriesDP, 'f', 4, 64),
+		})
+	}
+	return toWrite
+}
@@ -0,0 +1,39 @@
+package analysis
+
+import (
+	"math"
+	"testing"
+)
+
+func Test_wordDistribution(t *testing.T) {
+	tests := []struct {
+		name        string
+		occurrences []wordOccurrence
+		numTexts    int
+		numTokens   uint
+		wantHits    uint
+		wantIPM     float64
+		wantD       float64
+		wantDP      float64
+	}{
+		{"even", []wordOccurrence{{1, 10}, {1, 10}}, 2, 20, 2, 2000, 1, 0},
+		{"one of two texts", []wordOccurrence{{2, 10}}, 2, 20, 2, 2000, 0, 0.5},
+		{"single text", []wordOccurrence{{3, 10}}, 1, 10, 3, 3000, 1, 0},
+		{
+			"growing", []wordOccurrence{{1, 10}, {2, 10}, {3, 10}, {4, 10}, {5, 10}}, 5, 50, 15, 15000,
+			1 - math.Sqrt(0.02)/0.3/2, 0.2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := wordDistribution("слово", tt.occurrences, tt.numTexts, tt.numTokens, 1000)
+			if got.Hits != tt.wantHits || got.Texts != uint(len(tt.occurrences)) ||
+				math.Abs(got.IPM-tt.wantIPM) > 1e-9 ||
+				math.Abs(got.JuillandD-tt.wantD) > 1e-9 ||
+				math.Abs(got.GriesDP-tt.wantDP) > 1e-9 {
+				t.Errorf("wordDistribution() = %+v, want hits %v, ipm %v, D %v, DP %v",
+					got, tt.wantHits, tt.wantIPM, tt.wantD, tt.wantDP)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/thecsw/katya/storage"
+	"github.com/thecsw/katya/utils"
+)
+
+const (
+	// BM25K1 is how quickly the repeats of a term stop adding to the score
+	BM25K1 = 1.2
+	// BM25B is how much the length of a text weighs its score down
+	BM25B = 0.75
+	// snippetWidth is how many tokens the snippet of a document has
+	snippetWidth = 30
+)
+
+// Document is a text ranked by how much it is about the query
+type Document struct {
+	// URL is the text's URL
+	URL string `json:"url"`
+	// Title is the text's title
+	Title string `json:"title"`
+	// Source is the link of one of the scope's sources the text belongs to
+	Source string `json:"source"`
+	// Score is the BM25 score of the text
+	Score float64 `json:"score"`
+	// Snippet is the part of the text with the most of the query in it, the
+	// matched words are marked like in FindRelations
+	Snippet string `json:"snippet"`
+}
+
+// scoredDocument is a text being ranked with the positions of its terms
+type scoredDocument struct {
+	textID    uint
+	score     float64
+	positions map[string][]int
+}
+
+// SearchDocuments ranks the scope's texts by BM25 over the lemmas of the
+// query's tokens, which have to be lemmas themselves, returns the limit
+// best documents after the offset and the number of all matched texts
+func SearchDocuments(scope storage.Scope, query string, limit, offset int) ([]Document, int, error) {
+	terms := make([]string, 0, 4)
+	seen := make(map[string]bool)
+	for _, token := range strings.Fields(query) {
+		term := storage.IndexTerm("lemmas", token)
+		if !seen[term] {
+			terms = append(terms, term)
+			seen[term] = true
+		}
+	}
+	if len(terms) == 0 {
+		return nil, 0, errors.New("empty query")
+	}
+	sources, err := storage.GetScopeSources(scope)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to get the sources")
+	}
+	numTexts, numWords, err := storage.CountScopedTexts(scope)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to count the texts")
+	}
+	postings, err := storage.FindDocumentPostingsInScope("lemmas", scope, terms)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to look up the terms")
+	}
+	scored := scoreDocuments(postings, numTexts, numWords)
+
+	page := scored[utils.Min(offset, len(scored)):utils.Min(offset+limit, len(scored))]
+	textIDs := make([]uint, len(page))
+	for i, v := range page {
+		textIDs[i] = v.textID
+	}
+	texts, err := storage.GetTextsByIDs(textIDs)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to get the texts")
+	}
+	links, err := storage.GetTextsSourcesInScope(scope, textIDs)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to get the texts' sources")
+	}
+	sourceLinks := make(map[uint]string, len(sources))
+	for _, v := range sources {
+		sourceLinks[v.ID] = v.Link
+	}
+	textSources := make(map[uint]string, len(links))
+	for _, v := range links {
+		if _, ok := textSources[v.TextID]; !ok {
+			textSources[v.TextID] = sourceLinks[v.SourceID]
+		}
+	}
+	textsByID := make(map[uint]storage.Text, len(texts))
+	for _, v := range texts {
+		textsByID[v.ID] = v
+	}
+
+	documents := make([]Document, 0, len(page))
+	for _, v := range page {
+		text, ok := textsByID[v.textID]
+		if !ok {
+			continue
+		}
+		documents = append(documents, Document{
+			URL:     text.URL,
+			Title:   text.Title,
+			Source:  textSources[text.ID],
+			Score:   v.score,
+			Snippet: bestSnippet(strings.Split(text.Text, " "), v.positions, snippetWidth),
+		})
+	}
+	return documents, len(scored), nil
+}
+
+// scoreDocuments scores every text of the postings by BM25 from the best
+// one, out of numTexts texts with numWords words in the scope, a term's
+// document frequency is the number of the postings' texts it occurs in, the
+// matched texts stand in for the scope if their words weren't counted yet
+func scoreDocuments(postings []storage.DocumentPosting, numTexts, numWords uint) []scoredDocument {
+	matched := make(map[uint]uint)
+	termTexts := make(map[string]uint)
+	for _, v := range postings {
+		matched[v.TextID] = v.Length
+		termTexts[v.Term]++
+	}
+	if numTexts < uint(len(matched)) || numWords == 0 {
+		numTexts, numWords = uint(len(matched)), 0
+		for _, length := range matched {
+			numWords += length
+		}
+	}
+	averageLength := 1.0
+	if numTexts > 0 && numWords > 0 {
+		averageLength = float64(numWords) / float64(numTexts)
+	}
+
+	documents := make(map[uint]*scoredDocument, len(matched))
+	for _, v := range postings {
+		document, ok := documents[v.TextID]
+		if !ok {
+			document = &scoredDocument{textID: v.TextID, positions: make(map[string][]int)}
+			documents[v.TextID] = document
+		}
+		document.positions[v.Term] = v.Positions
+		document.score += bm25IDF(numTexts, termTexts[v.Term]) * bm25TF(uint(len(v.Positions)), v.Length, averageLength)
+	}
+	scored := make([]scoredDocument, 0, len(documents))
+	for _, v := range documents {
+		scored = append(scored, *v)
+	}
+	sort.Slice(scored, func(i, j int) bool {
+		if scored[i].score != scored[j].score {
+			return scored[i].score > scored[j].score
+		}
+		return scored[i].textID < scored[j].textID
+	})
+	return scored
+}
+
+// bm25IDF is the inverse document frequency of a term that occurs in
+// frequency out of numTexts texts, it never goes below zero
+func bm25IDF(numTexts, frequency uint) float64 {
+	n, df := float64(numTexts), float64(frequency)
+	return math.Log(1 + (n-df+0.5)/(df+0.5))
+}
+
+// bm25TF is the saturated term frequency of a term that occurs count times
+// in a text of the given length, relative to the average length
+func bm25TF(count, length uint, averageLength float64) float64 {
+	tf := float64(count)
+	return tf * (BM25K1 + 1) / (tf + BM25K1*(1-BM25B+BM25B*float64(length)/averageLength))
+}
+
+// bestSnippet returns width tokens around the window with the most distinct
+// terms in it, the more occurrences the better if there are as many terms,
+// with every occurrence marked
+func bestSnippet(tokens []string, positions map[string][]int, width int) string {
+	termAt := make(map[int]string)
+	starts := make([]int, 0, 16)
+	for term, v := range positions {
+		for _, position := range v {
+			if position >= 0 && position < len(tokens) {
+				termAt[position] = term
+				starts = append(starts, position)
+			}
+		}
+	}
+	if len(starts) == 0 {
+		return strings.Join(tokens[:utils.Min(width, len(tokens))], " ")
+	}
+	sort.Ints(starts)
+	best, bestTerms, bestHits, bestLast := starts[0], 0, 0, starts[0]
+	for i, start := range starts {
+		terms := make(map[string]bool)
+		hits, last := 0, start
+		for _, position := range starts[i:] {
+			if position >= start+width {
+				break
+			}
+			terms[termAt[position]] = true
+			hits++
+			last = position
+		}
+		if len(terms) > bestTerms || (len(terms) == bestTerms && hits > bestHits) {
+			best, bestTerms, bestHits, bestLast = start, len(terms), hits, last
+		}
+	}
+	// Center the matched part of the window
+	left := utils.Max(0, best-(width-(bestLast-best+1))/2)
+	right := utils.Min(len(tokens), left+width)
+	left = utils.Max(0, right-width)
+	snippet := append([]string{}, tokens[left:right]...)
+	for i := range snippet {
+		if _, ok := termAt[left+i]; ok {
+			snippet[i] = "?>" + snippet[i] + "<?"
+		}
+	}
+	return strings.Join(snippet, " ")
+}
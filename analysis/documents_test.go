@@ -0,0 +1,60 @@
+package analysis
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/thecsw/katya/storage"
+)
+
+func Test_scoreDocuments(t *testing.T) {
+	postings := []storage.DocumentPosting{
+		{TextID: 1, Term: "книга", Positions: []int{0}, Length: 100},
+		{TextID: 2, Term: "книга", Positions: []int{0, 5, 9}, Length: 100},
+		{TextID: 3, Term: "книга", Positions: []int{0, 5, 9}, Length: 1000},
+		{TextID: 3, Term: "стол", Positions: []int{2}, Length: 1000},
+	}
+	tests := []struct {
+		name     string
+		numTexts uint
+		numWords uint
+		want     []uint
+	}{
+		{"rare term wins", 10, 3000, []uint{3, 2, 1}},
+		{"uncounted words", 10, 0, []uint{3, 2, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scored := scoreDocuments(postings, tt.numTexts, tt.numWords)
+			got := make([]uint, len(scored))
+			for i, v := range scored {
+				got[i] = v.textID
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("scoreDocuments() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_bestSnippet(t *testing.T) {
+	tokens := strings.Split("книга лежит на столе , а под столом лежит другая книга и ещё одна книга", " ")
+	tests := []struct {
+		name      string
+		positions map[string][]int
+		width     int
+		want      string
+	}{
+		{"most terms", map[string][]int{"книга": {0, 10, 14}, "стол": {7}}, 5, "?>столом<? лежит другая ?>книга<? и"},
+		{"most hits", map[string][]int{"книга": {0, 10, 14}}, 5, "?>книга<? и ещё одна ?>книга<?"},
+		{"nothing", nil, 3, "книга лежит на"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bestSnippet(tokens, tt.positions, tt.width); got != tt.want {
+				t.Errorf("bestSnippet() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"github.com/thecsw/katya/storage"
+)
+
+const (
+	// percentDiffZero stands in for a zero reference frequency in %DIFF,
+	// as suggested by Gabrielatos and Marchi (2012), to keep it finite
+	percentDiffZero = 1e-18
+	// logRatioZero stands in for a zero frequency in the log ratio,
+	// as suggested by Hardie (2014)
+	logRatioZero = 0.5
+)
+
+// Keyword is a single word compared between a focus and a reference corpus,
+// the frequencies are normalized per million words of their corpus
+type Keyword struct {
+	// Word is the word being compared, see FrequencyOptions
+	Word string `json:"word"`
+	// Focus is the number of times the word occurs in the focus corpus
+	Focus uint `json:"focus"`
+	// Reference is the number of times the word occurs in the reference corpus
+	Reference uint `json:"reference"`
+	// FocusIPM is the frequency per million words in the focus corpus
+	FocusIPM float64 `json:"focus_ipm"`
+	// ReferenceIPM is the frequency per million words in the reference corpus
+	ReferenceIPM float64 `json:"reference_ipm"`
+	// LogLikelihood is Dunning's G2, negative if the word is underused in the focus
+	LogLikelihood float64 `json:"log_likelihood"`
+	// PValue is the probability of a G2 this high by chance (chi-squared, 1 df)
+	PValue float64 `json:"p_value"`
+	// PercentDiff is the %DIFF effect size of Gabrielatos and Marchi
+	PercentDiff float64 `json:"percent_diff"`
+	// SimpleMaths is Kilgarriff's smoothed ratio of the normalized frequencies
+	SimpleMaths float64 `json:"simple_maths"`
+	// LogRatio is Hardie's binary log of the ratio of the normalized frequencies
+	LogRatio float64 `json:"log_ratio"`
+}
+
+var (
+	// KeynessMeasures maps the names of the measures to the values keywords are sorted by
+	KeynessMeasures = map[string]func(k Keyword) float64{
+		"log_likelihood": func(k Keyword) float64 { return k.LogLikelihood },
+		"percent_diff":   func(k Keyword) float64 { return k.PercentDiff },
+		"simple_maths":   func(k Keyword) float64 { return k.SimpleMaths },
+		"log_ratio":      func(k Keyword) float64 { return k.LogRatio },
+	}
+)
+
+// FindKeywords compares the word frequencies of the focus scope against the
+// reference scope, smoothing is the constant of the simple maths ratio
+func FindKeywords(focus, reference storage.Scope, smoothing float64, options FrequencyOptions) ([]Keyword, error) {
+	focusFrequencies, focusSize, err := countKeywordFrequencies(focus, options)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to count the focus")
+	}
+	referenceFrequencies, referenceSize, err := countKeywordFrequencies(reference, options)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to count the reference")
+	}
+	return keywordsOf(focusFrequencies, referenceFrequencies, focusSize, referenceSize, smoothing), nil
+}
+
+// countKeywordFrequencies is FindTheMostFrequentWords that also returns the
+// size of the scope, which is all of its tokens, even the ones the options
+// don't count, so keeping a single part of speech doesn't inflate its share
+func countKeywordFrequencies(scope storage.Scope, options FrequencyOptions) (map[string]uint, uint, error) {
+	frequencies := make(map[string]uint)
+	size := uint(0)
+	err := storage.WalkScopedTexts(scope, frequencyBatchSize, func(texts []storage.Text) error {
+		for i := range texts {
+			keys, textSize := frequencyKeys(&texts[i], options)
+			for _, key := range keys {
+				if key != "" {
+					frequencies[key]++
+				}
+			}
+			size += textSize
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "couldn't retrieve scope texts")
+	}
+	return frequencies, size, nil
+}
+
+// keywordsOf computes the keyness of every word out of two frequency lists
+// and the number of tokens of their corpora
+func keywordsOf(focus, reference map[string]uint, focusTokens, referenceTokens uint, smoothing float64) []Keyword {
+	focusSize, referenceSize := float64(focusTokens), float64(referenceTokens)
+	keywords := make([]Keyword, 0, len(focus))
+	if focusSize == 0 || referenceSize == 0 {
+		return keywords
+	}
+	words := make(map[string]bool, len(focus)+len(reference))
+	for k := range focus {
+		words[k] = true
+	}
+	for k := range reference {
+		words[k] = true
+	}
+	for word := range words {
+		a, b := float64(focus[word]), float64(reference[word])
+		keyword := Keyword{
+			Word:         word,
+			Focus:        focus[word],
+			Reference:    reference[word],
+			FocusIPM:     a / focusSize * 1e6,
+			ReferenceIPM: b / referenceSize * 1e6,
+		}
+		// Expected frequencies if the word was spread evenly over both corpora
+		e1 := focusSize * (a + b) / (focusSize + referenceSize)
+		e2 := referenceSize * (a + b) / (focusSize + referenceSize)
+		if a > 0 {
+			keyword.LogLikelihood += a * math.Log(a/e1)
+		}
+		if b > 0 {
+			keyword.LogLikelihood += b * math.Log(b/e2)
+		}
+		// Rounding can push an even spread a hair below zero
+		keyword.LogLikelihood = math.Max(0, 2*keyword.LogLikelihood)
+		keyword.PValue = math.Erfc(math.Sqrt(keyword.LogLikelihood / 2))
+		if a < e1 {
+			keyword.LogLikelihood = -keyword.LogLikelihood
+		}
+		keyword.PercentDiff = (keyword.FocusIPM - keyword.ReferenceIPM) * 100 /
+			math.Max(keyword.ReferenceIPM, percentDiffZero)
+		keyword.SimpleMaths = (keyword.FocusIPM + smoothing) / (keyword.ReferenceIPM + smoothing)
+		keyword.LogRatio = math.Log2(
+			(math.Max(a, logRatioZero) / focusSize) / (math.Max(b, logRatioZero) / referenceSize),
+		)
+		keywords = append(keywords, keyword)
+	}
+	return keywords
+}
+
+// FilterKeywords keeps the positive keywords (overused in the focus) or the
+// negative ones (underused), which occur at least minFreq times in the corpus
+// they're characteristic of and whose p-value is at most maxP, the stoplist
+// words and punctuation are dropped just like in FilterStopwordsSimple
+func FilterKeywords(keywords []Keyword, stoplist map[string]bool, minFreq uint, maxP float64, negative bool) []Keyword {
+	filtered := make([]Keyword, 0, len(keywords))
+	for _, v := range keywords {
+		if (v.LogLikelihood < 0) != negative || v.LogLikelihood == 0 || v.PValue > maxP {
+			continue
+		}
+		if (!negative && v.Focus < minFreq) || (negative && v.Reference < minFreq) {
+			continue
+		}
+		word := frequencyKeyWord(v.Word)
+		if _, isStopword := stoplist[strings.ToLower(word)]; isStopword {
+			continue
+		}
+		if unicodeIsThis(word, unicode.IsPunct) || unicodeIsThis(word, unicode.IsSymbol) {
+			continue
+		}
+		filtered = append(filtered, v)
+	}
+	return filtered
+}
+
+// SortKeywords sorts the keywords from the most characteristic one, which is
+// the highest value of the measure, or the lowest one for negative keywords
+func SortKeywords(keywords []Keyword, measure string, negative bool) {
+	score := KeynessMeasures[measure]
+	sort.Slice(keywords, func(i, j int) bool {
+		a, b := score(keywords[i]), score(keywords[j])
+		if a != b {
+			return (a > b) != negative
+		}
+		return keywords[i].Word < keywords[j].Word
+	})
+}
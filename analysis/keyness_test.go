@@ -0,0 +1,51 @@
+package analysis
+
+import (
+	"math"
+	"testing"
+)
+
+func Test_keywordsOf(t *testing.T) {
+	focus := map[string]uint{"брат": 30, "деньги": 10, "дом": 60}
+	reference := map[string]uint{"брат": 10, "деньги": 10, "дом": 80, "поле": 100}
+	byWord := make(map[string]Keyword)
+	for _, v := range keywordsOf(focus, reference, 100, 200, 1) {
+		byWord[v.Word] = v
+	}
+	tests := []struct {
+		name  string
+		word  string
+		value func(k Keyword) float64
+		want  float64
+	}{
+		{"focus ipm", "брат", func(k Keyword) float64 { return k.FocusIPM }, 300000},
+		{"reference ipm", "брат", func(k Keyword) float64 { return k.ReferenceIPM }, 50000},
+		{"log likelihood", "брат", func(k Keyword) float64 { return k.LogLikelihood },
+			2 * (30*math.Log(30/(100*40.0/300)) + 10*math.Log(10/(200*40.0/300)))},
+		{"negative log likelihood", "поле", func(k Keyword) float64 { return k.LogLikelihood },
+			-2 * 100 * math.Log(100/(200*100.0/300))},
+		{"percent diff", "брат", func(k Keyword) float64 { return k.PercentDiff }, 500},
+		{"simple maths", "деньги", func(k Keyword) float64 { return k.SimpleMaths }, 100001.0 / 50001},
+		{"log ratio", "брат", func(k Keyword) float64 { return k.LogRatio }, math.Log2(6)},
+		{"log ratio of a zero", "поле", func(k Keyword) float64 { return k.LogRatio }, math.Log2(0.005 / 0.5)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyword, ok := byWord[tt.word]
+			if !ok {
+				t.Fatalf("keywordsOf() has no %q", tt.word)
+			}
+			if got := tt.value(keyword); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("keywordsOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_keywordsOfSizes(t *testing.T) {
+	// Only nouns are counted, but the corpora have a thousand tokens each
+	keywords := keywordsOf(map[string]uint{"брат": 30}, map[string]uint{"брат": 10}, 1000, 1000, 1)
+	if len(keywords) != 1 || keywords[0].FocusIPM != 30000 || keywords[0].ReferenceIPM != 10000 {
+		t.Errorf("keywordsOf() = %v, want ipm of 30000 and 10000", keywords)
+	}
+}
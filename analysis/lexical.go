@@ -0,0 +1,201 @@
+package analysis
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"github.com/thecsw/katya/storage"
+)
+
+const (
+	// STTRChunk is the number of tokens the standardized TTR is averaged over
+	STTRChunk = 1000
+	// maxGrowthPoints caps the vocabulary growth curve, the curve gets
+	// thinned out to every other point whenever it grows over the cap
+	maxGrowthPoints = 500
+	// rankStep is how much the next rank of the rank-frequency curve is
+	// multiplied by, so the curve is spread evenly on a log scale
+	rankStep = 1.1
+)
+
+// LexicalStats are the lexical statistics of a set of texts, where tokens
+// are words without punctuation, and types are their lowercased forms
+type LexicalStats struct {
+	// Texts is the number of texts counted
+	Texts uint `json:"texts"`
+	// Tokens is the number of words
+	Tokens uint `json:"tokens"`
+	// Types is the number of distinct words
+	Types uint `json:"types"`
+	// Lemmas is the number of distinct lemmas
+	Lemmas uint `json:"lemmas"`
+	// TTR is the type-token ratio
+	TTR float64 `json:"ttr"`
+	// STTR is the mean TTR of every STTRChunk tokens, the plain TTR if
+	// there are fewer tokens than that
+	STTR float64 `json:"sttr"`
+	// Hapaxes is the number of types that occur only once
+	Hapaxes uint `json:"hapaxes"`
+	// DisLegomena is the number of types that occur exactly twice
+	DisLegomena uint `json:"dis_legomena"`
+	// MeanSentenceLength is the number of words per sentence
+	MeanSentenceLength float64 `json:"mean_sentence_length"`
+	// Growth is the vocabulary growth curve (Heaps' law)
+	Growth []CurvePoint `json:"growth"`
+	// RankFrequency is the rank-frequency curve of the types (Zipf's law)
+	RankFrequency []CurvePoint `json:"rank_frequency"`
+}
+
+// CurvePoint is a single point of a curve
+type CurvePoint struct {
+	X uint `json:"x"`
+	Y uint `json:"y"`
+}
+
+// lexicalCounter goes through texts one by one and keeps the counts
+// the lexical statistics are computed from
+type lexicalCounter struct {
+	stats  LexicalStats
+	types  map[string]uint
+	lemmas map[string]bool
+	// chunk are the types seen in the current chunk of the STTR
+	chunk      map[string]bool
+	chunkSize  uint
+	chunkTTRs  []float64
+	growthStep uint
+	words      uint
+	sentences  uint
+}
+
+// newLexicalCounter creates an empty counter, growthStep is the number of
+// tokens between the first points of the vocabulary growth curve
+func newLexicalCounter(growthStep uint) *lexicalCounter {
+	if growthStep == 0 {
+		growthStep = STTRChunk
+	}
+	return &lexicalCounter{
+		types:      make(map[string]uint),
+		lemmas:     make(map[string]bool),
+		chunk:      make(map[string]bool),
+		growthStep: growthStep,
+	}
+}
+
+// FindLexicalStats computes the lexical statistics of the scope's texts,
+// growthStep is the number of tokens between the points of the growth curve
+func FindLexicalStats(scope storage.Scope, growthStep uint) (*LexicalStats, error) {
+	counter := newLexicalCounter(growthStep)
+	err := storage.WalkScopedTexts(scope, frequencyBatchSize, func(texts []storage.Text) error {
+		for i := range texts {
+			counter.add(&texts[i])
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't retrieve scope texts")
+	}
+	return counter.result(), nil
+}
+
+// add counts a single text
+func (c *lexicalCounter) add(text *storage.Text) {
+	c.stats.Texts++
+	c.words += text.NumWords
+	c.sentences += text.NumSentences
+	tokens := strings.Split(text.Text, " ")
+	lemmas := strings.Split(text.Lemmas, " ")
+	aligned := len(tokens) == len(lemmas)
+	for i, token := range tokens {
+		if token == "" || unicodeIsThis(token, unicode.IsPunct) || unicodeIsThis(token, unicode.IsSymbol) {
+			continue
+		}
+		word := strings.ToLower(token)
+		c.stats.Tokens++
+		c.types[word]++
+		if aligned {
+			c.lemmas[strings.ToLower(lemmas[i])] = true
+		}
+
+		c.chunk[word] = true
+		c.chunkSize++
+		if c.chunkSize == STTRChunk {
+			c.chunkTTRs = append(c.chunkTTRs, float64(len(c.chunk))/STTRChunk)
+			c.chunk, c.chunkSize = make(map[string]bool), 0
+		}
+
+		if c.stats.Tokens%c.growthStep == 0 {
+			c.stats.Growth = append(c.stats.Growth, CurvePoint{X: c.stats.Tokens, Y: uint(len(c.types))})
+			if len(c.stats.Growth) > maxGrowthPoints {
+				c.thinGrowth()
+			}
+		}
+	}
+}
+
+// thinGrowth keeps every other point of the growth curve and doubles its step
+func (c *lexicalCounter) thinGrowth() {
+	c.growthStep *= 2
+	thinned := c.stats.Growth[:0]
+	for _, point := range c.stats.Growth {
+		if point.X%c.growthStep == 0 {
+			thinned = append(thinned, point)
+		}
+	}
+	c.stats.Growth = thinned
+}
+
+// result computes the final statistics out of the counts
+func (c *lexicalCounter) result() *LexicalStats {
+	stats := c.stats
+	stats.Types = uint(len(c.types))
+	stats.Lemmas = uint(len(c.lemmas))
+	if stats.Tokens > 0 {
+		stats.TTR = float64(stats.Types) / float64(stats.Tokens)
+	}
+	stats.STTR = stats.TTR
+	if len(c.chunkTTRs) > 0 {
+		sum := 0.0
+		for _, ttr := range c.chunkTTRs {
+			sum += ttr
+		}
+		stats.STTR = sum / float64(len(c.chunkTTRs))
+	}
+	if c.sentences > 0 {
+		stats.MeanSentenceLength = float64(c.words) / float64(c.sentences)
+	}
+
+	frequencies := make([]uint, 0, len(c.types))
+	for _, v := range c.types {
+		frequencies = append(frequencies, v)
+		switch v {
+		case 1:
+			stats.Hapaxes++
+		case 2:
+			stats.DisLegomena++
+		}
+	}
+	sort.Slice(frequencies, func(i, j int) bool { return frequencies[i] > frequencies[j] })
+
+	// The growth curve always ends with the final vocabulary size
+	if n := len(stats.Growth); stats.Tokens > 0 && (n == 0 || stats.Growth[n-1].X != stats.Tokens) {
+		stats.Growth = append(stats.Growth, CurvePoint{X: stats.Tokens, Y: stats.Types})
+	}
+	stats.RankFrequency = make([]CurvePoint, 0, 64)
+	for rank := 1; rank <= len(frequencies); {
+		stats.RankFrequency = append(stats.RankFrequency, CurvePoint{X: uint(rank), Y: frequencies[rank-1]})
+		if rank == len(frequencies) {
+			break
+		}
+		next := int(float64(rank) * rankStep)
+		if next <= rank {
+			next = rank + 1
+		}
+		if next > len(frequencies) {
+			next = len(frequencies)
+		}
+		rank = next
+	}
+	return &stats
+}
@@ -0,0 +1,52 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/thecsw/katya/storage"
+)
+
+func Test_lexicalCounter(t *testing.T) {
+	counter := newLexicalCounter(2)
+	counter.add(&storage.Text{
+		Text:         "Мама мыла раму , мама мыла пол .",
+		Lemmas:       "мама мыть рама , мама мыть пол .",
+		NumWords:     6,
+		NumSentences: 1,
+	})
+	counter.add(&storage.Text{
+		Text:         "Рама чистая !",
+		Lemmas:       "рама чистый !",
+		NumWords:     2,
+		NumSentences: 1,
+	})
+	got := counter.result()
+	want := &LexicalStats{
+		Texts:              2,
+		Tokens:             8,
+		Types:              6,
+		Lemmas:             5,
+		TTR:                0.75,
+		STTR:               0.75,
+		Hapaxes:            4,
+		DisLegomena:        2,
+		MeanSentenceLength: 4,
+		Growth:             []CurvePoint{{2, 2}, {4, 3}, {6, 4}, {8, 6}},
+		RankFrequency:      []CurvePoint{{1, 2}, {2, 2}, {3, 1}, {4, 1}, {5, 1}, {6, 1}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("result() = %+v, want %+v", got, want)
+	}
+}
+
+func Test_lexicalCounter_thinGrowth(t *testing.T) {
+	counter := newLexicalCounter(1)
+	counter.stats.Growth = []CurvePoint{{1, 1}, {2, 2}, {3, 3}, {4, 3}}
+	counter.thinGrowth()
+	want := []CurvePoint{{2, 2}, {4, 3}}
+	if !reflect.DeepEqual(counter.stats.Growth, want) || counter.growthStep != 2 {
+		t.Errorf("thinGrowth() = %v with step %d, want %v with step 2",
+			counter.stats.Growth, counter.growthStep, want)
+	}
+}
@@ -0,0 +1,107 @@
+package analysis
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/thecsw/katya/storage"
+)
+
+const (
+	// MinNGram is the shortest n-gram we extract
+	MinNGram = 2
+	// MaxNGram is the longest n-gram we extract
+	MaxNGram = 5
+)
+
+// NGramFilter tells which n-grams are dropped while counting, the
+// filters look at the words and lemmas aligned with the layer, so tag
+// n-grams can be filtered by punctuation and stopwords just the same
+type NGramFilter struct {
+	// Punctuation drops the n-grams with a punctuation or symbol token
+	Punctuation bool
+	// Stopwords drops the n-grams that start or end with a stopword
+	Stopwords bool
+}
+
+// FindNGrams counts every n-gram of the layer within the texts of a scope,
+// the stoplist is what the stopwords filter drops
+func FindNGrams(scope storage.Scope, layer string, n int, filter NGramFilter, stoplist map[string]bool) (map[string]uint, error) {
+	counts := make(map[string]uint)
+	err := storage.WalkScopedTexts(scope, frequencyBatchSize, func(texts []storage.Text) error {
+		for i := range texts {
+			countNGrams(counts,
+				layer,
+				strings.Split(storage.TextLayers(&texts[i])[layer], " "),
+				strings.Split(texts[i].Text, " "),
+				strings.Split(texts[i].Lemmas, " "),
+				n, filter, stoplist,
+			)
+		}
+		return nil
+	})
+	return counts, err
+}
+
+// countNGrams adds the n-grams of the tokens of a layer to the counts,
+// words and lemmas are the aligned layers the filters are applied to
+func countNGrams(counts map[string]uint, layer string, tokens, words, lemmas []string, n int, filter NGramFilter, stoplist map[string]bool) {
+	aligned := len(words) == len(tokens) && len(lemmas) == len(tokens)
+	// dropped marks the tokens no n-gram can go through
+	dropped := make([]bool, len(tokens))
+	for i, token := range tokens {
+		dropped[i] = token == ""
+		if filter.Punctuation && aligned {
+			dropped[i] = dropped[i] || unicodeIsThis(words[i], unicode.IsPunct) || unicodeIsThis(words[i], unicode.IsSymbol)
+		}
+	}
+	isStopword := func(i int) bool {
+		return filter.Stopwords && aligned && stoplist[strings.ToLower(lemmas[i])]
+	}
+	// Words and lemmas are counted regardless of their casing and spelling
+	_, folded := storage.MapNormalizedPartToFindFunction[layer]
+	terms := make([]string, n)
+	for start := 0; start+n <= len(tokens); start++ {
+		ok := true
+		for k := 0; k < n && ok; k++ {
+			ok = !dropped[start+k]
+		}
+		if !ok || isStopword(start) || isStopword(start+n-1) {
+			continue
+		}
+		for k := 0; k < n; k++ {
+			terms[k] = tokens[start+k]
+			if folded {
+				terms[k] = storage.IndexTerm(layer, terms[k])
+			}
+		}
+		counts[strings.Join(terms, " ")]++
+	}
+}
+
+// TopNGrams returns the n-grams seen at least minFreq times, from the most
+// frequent one, as the rows of n-gram and its count, top caps the rows
+func TopNGrams(counts map[string]uint, minFreq uint, top int) [][]string {
+	p := make(PairListSimple, 0, len(counts))
+	for k, v := range counts {
+		if v >= minFreq {
+			p = append(p, PairSimple{k, v})
+		}
+	}
+	sort.Slice(p, func(i, j int) bool {
+		if p[i].Value != p[j].Value {
+			return p[i].Value > p[j].Value
+		}
+		return p[i].Key < p[j].Key
+	})
+	if top > 0 && len(p) > top {
+		p = p[:top]
+	}
+	toWrite := make([][]string, 0, len(p))
+	for _, v := range p {
+		toWrite = append(toWrite, []string{v.Key, strconv.FormatUint(uint64(v.Value), 10)})
+	}
+	return toWrite
+}
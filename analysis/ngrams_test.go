@@ -0,0 +1,45 @@
+package analysis
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_countNGrams(t *testing.T) {
+	stoplist := map[string]bool{"и": true}
+	words := strings.Split("Новую книгу , новую книгу и старую книгу", " ")
+	lemmas := strings.Split("новый книга , новый книга и старый книга", " ")
+	tags := strings.Split("ADJ NOUN PUNCT ADJ NOUN CCONJ ADJ NOUN", " ")
+	tests := []struct {
+		name   string
+		layer  string
+		tokens []string
+		n      int
+		filter NGramFilter
+		want   map[string]uint
+	}{
+		{"lowercased words", "text", words, 2, NGramFilter{Punctuation: true}, map[string]uint{
+			"новую книгу": 2, "книгу и": 1, "и старую": 1, "старую книгу": 1,
+		}},
+		{"tags without punctuation", "tags", tags, 3, NGramFilter{Punctuation: true}, map[string]uint{
+			"ADJ NOUN CCONJ": 1, "NOUN CCONJ ADJ": 1, "CCONJ ADJ NOUN": 1,
+		}},
+		{"stopwords at the edges", "lemmas", lemmas, 3, NGramFilter{Punctuation: true, Stopwords: true}, map[string]uint{
+			"книга и старый": 1,
+		}},
+		{"no filters", "lemmas", lemmas, 4, NGramFilter{}, map[string]uint{
+			"новый книга , новый": 1, "книга , новый книга": 1, ", новый книга и": 1,
+			"новый книга и старый": 1, "книга и старый книга": 1,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make(map[string]uint)
+			countNGrams(got, tt.layer, tt.tokens, words, lemmas, tt.n, tt.filter, stoplist)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("countNGrams() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
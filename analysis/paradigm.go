@@ -0,0 +1,90 @@
+package analysis
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/thecsw/katya/storage"
+	"github.com/thecsw/katya/utils"
+)
+
+const (
+	// paradigmBatchSize is how many texts we load at a time for a paradigm
+	paradigmBatchSize = 100
+	// paradigmExampleWidth is how many tokens an example has on each side
+	paradigmExampleWidth = 10
+)
+
+// ParadigmForm is a single surface form a lemma was realised as
+type ParadigmForm struct {
+	// Form is the lowercased surface form
+	Form string `json:"form"`
+	// Count is the number of times the form occurs
+	Count uint `json:"count"`
+	// Tags are the tags the form was given with their counts
+	Tags map[string]uint `json:"tags"`
+	// Example is the first occurrence of the form in the texts
+	Example Evidence `json:"example"`
+}
+
+// FindParadigm walks through every occurrence of the lemma in the scope's
+// texts, found through the inverted index, and groups them by the surface
+// forms in the aligned text layer, from the most frequent form
+func FindParadigm(scope storage.Scope, lemma string) ([]ParadigmForm, error) {
+	starts, err := storage.FindPhraseStartsInScope("lemmas", scope, []string{storage.IndexTerm("lemmas", lemma)})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to look up the lemma")
+	}
+	forms := make(map[string]*ParadigmForm)
+	textIDs := storage.SortedTextIDs(starts)
+	for i := 0; i < len(textIDs); i += paradigmBatchSize {
+		texts, err := storage.GetTextsByIDs(textIDs[i:utils.Min(len(textIDs), i+paradigmBatchSize)])
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get the texts")
+		}
+		for _, text := range texts {
+			addParadigmForms(forms, text, starts[text.ID])
+		}
+	}
+	result := make([]ParadigmForm, 0, len(forms))
+	for _, v := range forms {
+		result = append(result, *v)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Form < result[j].Form
+	})
+	return result, nil
+}
+
+// addParadigmForms adds the forms at the given token positions of the text,
+// the occurrence itself is marked in the example, like in FindRelations
+func addParadigmForms(forms map[string]*ParadigmForm, text storage.Text, positions []int) {
+	tokens := strings.Split(text.Text, " ")
+	tags := strings.Split(text.Tags, " ")
+	for _, position := range positions {
+		if position >= len(tokens) {
+			continue
+		}
+		form := strings.ToLower(tokens[position])
+		if _, ok := forms[form]; !ok {
+			left := utils.Max(0, position-paradigmExampleWidth)
+			right := utils.Min(len(tokens), position+paradigmExampleWidth+1)
+			example := append([]string{}, tokens[left:right]...)
+			example[position-left] = "?>" + example[position-left] + "<?"
+			forms[form] = &ParadigmForm{
+				Form:    form,
+				Tags:    make(map[string]uint),
+				Example: Evidence{Text: strings.Join(example, " "), Source: text.URL},
+			}
+		}
+		forms[form].Count++
+		// Tags should be aligned with the text, but let's not trust it blindly
+		if len(tags) == len(tokens) {
+			forms[form].Tags[tags[position]]++
+		}
+	}
+}
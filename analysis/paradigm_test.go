@@ -0,0 +1,45 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/thecsw/katya/storage"
+)
+
+func Test_addParadigmForms(t *testing.T) {
+	forms := make(map[string]*ParadigmForm)
+	addParadigmForms(forms, storage.Text{
+		URL:  "a",
+		Text: "Книга лежит на книге , а книга на полке",
+		Tags: "NOUN VERB ADP NOUN PUNCT CCONJ NOUN ADP NOUN",
+	}, []int{0, 3, 6})
+	addParadigmForms(forms, storage.Text{
+		URL:  "b",
+		Text: "Читаю книгу",
+		Tags: "VERB NOUN",
+	}, []int{1})
+	want := map[string]*ParadigmForm{
+		"книга": {
+			Form:    "книга",
+			Count:   2,
+			Tags:    map[string]uint{"NOUN": 2},
+			Example: Evidence{Text: "?>Книга<? лежит на книге , а книга на полке", Source: "a"},
+		},
+		"книге": {
+			Form:    "книге",
+			Count:   1,
+			Tags:    map[string]uint{"NOUN": 1},
+			Example: Evidence{Text: "Книга лежит на ?>книге<? , а книга на полке", Source: "a"},
+		},
+		"книгу": {
+			Form:    "книгу",
+			Count:   1,
+			Tags:    map[string]uint{"NOUN": 1},
+			Example: Evidence{Text: "Читаю ?>книгу<?", Source: "b"},
+		},
+	}
+	if !reflect.DeepEqual(forms, want) {
+		t.Errorf("addParadigmForms() = %v, want %v", forms, want)
+	}
+}
@@ -0,0 +1,147 @@
+package analysis
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/thecsw/katya/storage"
+	"github.com/thecsw/katya/utils"
+)
+
+const (
+	// MaxSpellingDistance is the most edits a suggested spelling can be away
+	MaxSpellingDistance = 2
+	// shortTokenLength is the length up to which tokens only get a single
+	// edit, otherwise every short word has a suggestion
+	shortTokenLength = 4
+	// spellingsPerToken is how many suggested spellings a token gets
+	spellingsPerToken = 5
+	// MaxFuzzyDistance caps the edit distance of fuzzy searches
+	MaxFuzzyDistance = 2
+	// maxFuzzyVariants is how many variants a fuzzy query token expands to
+	maxFuzzyVariants = 50
+)
+
+// Spelling is a vocabulary term suggested in place of a token
+type Spelling struct {
+	// Term is the suggested term
+	Term string `json:"term"`
+	// Count is how many times the term occurs
+	Count uint `json:"count"`
+	// Distance is the number of edits between the token and the term
+	Distance int `json:"distance"`
+}
+
+// TokenSpellings are the suggested spellings of a single query token
+type TokenSpellings struct {
+	// Token is the query token, see storage.IndexTerm
+	Token string `json:"token"`
+	// Known tells whether the token is in the vocabulary as it is
+	Known bool `json:"known"`
+	// Spellings are the close terms from the most likely one, unknown tokens only
+	Spellings []Spelling `json:"spellings"`
+}
+
+// DidYouMean is what a query could have meant if it found nothing
+type DidYouMean struct {
+	// Query is the query as it was given
+	Query string `json:"query"`
+	// Suggestion is the query with every unknown token replaced by its best
+	// spelling, it's empty if there is nothing to replace
+	Suggestion string `json:"suggestion"`
+	// Tokens are the spellings of every token of the query
+	Tokens []TokenSpellings `json:"tokens"`
+}
+
+// FindSpellings looks up every token of the query in the vocabulary of the
+// scope's sources for the layer and suggests the close spellings of the
+// tokens that aren't there, at most maxDistance edits away
+func FindSpellings(scope storage.Scope, layer, query string, maxDistance int) (*DidYouMean, error) {
+	tokens := strings.Fields(query)
+	terms := make([]string, len(tokens))
+	for i, token := range tokens {
+		terms[i] = storage.IndexTerm(layer, token)
+	}
+	counts, err := storage.FindVocabularyCounts(scope, layer, terms)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to look up the query tokens")
+	}
+	result := &DidYouMean{Query: query, Tokens: make([]TokenSpellings, 0, len(terms))}
+	suggestion := make([]string, len(terms))
+	replaced := false
+	for i, term := range terms {
+		suggestion[i] = term
+		if counts[term] > 0 {
+			result.Tokens = append(result.Tokens, TokenSpellings{Token: term, Known: true, Spellings: []Spelling{}})
+			continue
+		}
+		distance := maxDistance
+		if len([]rune(term)) <= shortTokenLength {
+			distance = utils.Min(distance, 1)
+		}
+		candidates, err := storage.FindVocabularyCandidates(scope, layer, term, distance)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to find the spelling candidates")
+		}
+		spellings := rankSpellings(term, candidates, distance, spellingsPerToken, true)
+		if len(spellings) > 0 {
+			suggestion[i] = spellings[0].Term
+			replaced = true
+		}
+		result.Tokens = append(result.Tokens, TokenSpellings{Token: term, Spellings: spellings})
+	}
+	if replaced {
+		result.Suggestion = strings.Join(suggestion, " ")
+	}
+	return result, nil
+}
+
+// ExpandFuzzy expands every term of a layer into the vocabulary terms of the
+// scope's sources that are at most maxDistance edits away from it, where
+// transpositions of adjacent letters are a single edit if asked, the term
+// itself always comes first, then the closest and most frequent variants
+func ExpandFuzzy(scope storage.Scope, layer string, terms []string, maxDistance int, transpositions bool) ([][]string, error) {
+	variants := make([][]string, len(terms))
+	for i, term := range terms {
+		candidates, err := storage.FindVocabularyCandidates(scope, layer, term, maxDistance)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to find the fuzzy candidates")
+		}
+		variants[i] = []string{term}
+		for _, v := range rankSpellings(term, candidates, maxDistance, maxFuzzyVariants, transpositions) {
+			variants[i] = append(variants[i], v.Term)
+		}
+	}
+	return variants, nil
+}
+
+// rankSpellings keeps the candidates within maxDistance edits of the term,
+// with transpositions if asked, and returns the top closest ones, the more
+// frequent ones first if they are as close
+func rankSpellings(term string, candidates []storage.Vocabulary, maxDistance, top int, transpositions bool) []Spelling {
+	spellings := make([]Spelling, 0, top)
+	for _, candidate := range candidates {
+		if candidate.Term == term {
+			continue
+		}
+		distance := utils.EditDistance(term, candidate.Term, maxDistance, transpositions)
+		if distance > maxDistance {
+			continue
+		}
+		spellings = append(spellings, Spelling{Term: candidate.Term, Count: candidate.Count, Distance: distance})
+	}
+	sort.SliceStable(spellings, func(i, j int) bool {
+		if spellings[i].Distance != spellings[j].Distance {
+			return spellings[i].Distance < spellings[j].Distance
+		}
+		if spellings[i].Count != spellings[j].Count {
+			return spellings[i].Count > spellings[j].Count
+		}
+		return spellings[i].Term < spellings[j].Term
+	})
+	if len(spellings) > top {
+		spellings = spellings[:top]
+	}
+	return spellings
+}
@@ -0,0 +1,48 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/thecsw/katya/storage"
+)
+
+func Test_rankSpellings(t *testing.T) {
+	candidates := []storage.Vocabulary{
+		{Term: "книга", Count: 10},
+		{Term: "книги", Count: 7},
+		{Term: "кнгиа", Count: 1},
+		{Term: "книгу", Count: 12},
+		{Term: "стол", Count: 40},
+	}
+	tests := []struct {
+		name           string
+		term           string
+		maxDistance    int
+		top            int
+		transpositions bool
+		want           []Spelling
+	}{
+		{"closest first", "кнгиу", 2, 3, true, []Spelling{
+			{Term: "книгу", Count: 12, Distance: 1},
+			{Term: "кнгиа", Count: 1, Distance: 1},
+			{Term: "книга", Count: 10, Distance: 2},
+		}},
+		{"levenshtein", "кнгиу", 1, 3, false, []Spelling{{Term: "кнгиа", Count: 1, Distance: 1}}},
+		{"frequent first", "книгк", 1, 5, true, []Spelling{
+			{Term: "книгу", Count: 12, Distance: 1},
+			{Term: "книга", Count: 10, Distance: 1},
+			{Term: "книги", Count: 7, Distance: 1},
+		}},
+		{"first letter missing", "нига", 1, 1, true, []Spelling{{Term: "книга", Count: 10, Distance: 1}}},
+		{"first letters swapped", "нкига", 1, 1, true, []Spelling{{Term: "книга", Count: 10, Distance: 1}}},
+		{"nothing close", "окно", 1, 5, true, []Spelling{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rankSpellings(tt.term, candidates, tt.maxDistance, tt.top, tt.transpositions); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rankSpellings() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
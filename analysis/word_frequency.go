@@ -7,26 +7,88 @@ import (
 	"github.com/thecsw/katya/storage"
 )
 
+const (
+	// frequencyBatchSize is how many texts we count at a time
+	frequencyBatchSize = 100
+)
+
+// FrequencyOptions tells what is counted as a single word, the
+// default is the lowercased lemma regardless of its part of speech
+type FrequencyOptions struct {
+	// Wordforms counts the surface words instead of the lemmas
+	Wordforms bool
+	// KeepCase doesn't fold the words to lowercase
+	KeepCase bool
+	// WithPOS counts a word together with its tag, like "стать VERB"
+	WithPOS bool
+	// POS only counts the words with these tags, all of them if empty
+	POS map[string]bool
+}
+
 // FindTheMostFrequentWords returns a map of all standard tokens with
-// the number of times they appeared within texts of a given source
-func FindTheMostFrequentWords(sourceURL string) (map[string]uint, error) {
-	source, err := storage.GetSource(sourceURL, false)
-	if err != nil || source.ID == 0 {
-		return nil, errors.Wrap(err, "failed mapping source to ID")
-	}
-	texts, err := storage.GetSourcesTexts(source.ID)
+// the number of times they appeared within texts of a given scope
+func FindTheMostFrequentWords(scope storage.Scope, options FrequencyOptions) (map[string]uint, error) {
+	finalFrequencies := make(map[string]uint)
+	err := storage.WalkScopedTexts(scope, frequencyBatchSize, func(texts []storage.Text) error {
+		for i := range texts {
+			keys, _ := frequencyKeys(&texts[i], options)
+			for _, key := range keys {
+				if key != "" {
+					finalFrequencies[key]++
+				}
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, errors.Wrap(err, "couldn't retrieve source texts")
+		return nil, errors.Wrap(err, "couldn't retrieve scope texts")
 	}
-	finalFrequencies := make(map[string]uint)
-	for _, text := range texts {
-		tokens := strings.Split(text.Lemmas, " ")
-		for _, token := range tokens {
-			lower := strings.ToLower(token)
-			finalFrequencies[lower]++
+	return finalFrequencies, nil
+}
+
+// frequencyKeys returns what is counted for every token of the text, where
+// an empty key isn't counted, and the number of tokens in the text. The tags
+// have to be aligned with the tokens to be used, otherwise nothing is counted
+func frequencyKeys(text *storage.Text, options FrequencyOptions) ([]string, uint) {
+	layer := text.Lemmas
+	if options.Wordforms {
+		layer = text.Text
+	}
+	tokens := strings.Split(layer, " ")
+	var tags []string
+	if options.WithPOS || len(options.POS) > 0 {
+		tags = strings.Split(text.Tags, " ")
+		if len(tags) != len(tokens) {
+			return nil, 0
+		}
+	}
+	keys := make([]string, len(tokens))
+	size := uint(0)
+	for i, token := range tokens {
+		if token == "" {
+			continue
+		}
+		size++
+		if len(options.POS) > 0 && !options.POS[tags[i]] {
+			continue
+		}
+		if !options.KeepCase {
+			token = strings.ToLower(token)
 		}
+		if options.WithPOS {
+			token += " " + tags[i]
+		}
+		keys[i] = token
+	}
+	return keys, size
+}
+
+// frequencyKeyWord returns the word of a counted key without its tag
+func frequencyKeyWord(key string) string {
+	if i := strings.IndexByte(key, ' '); i >= 0 {
+		return key[:i]
 	}
-	return finalFrequencies, err
+	return key
 }
 
 func unicodeIsThis(k string, isFunc func(rune) bool) bool {
@@ -0,0 +1,42 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/thecsw/katya/storage"
+)
+
+func Test_frequencyKeys(t *testing.T) {
+	text := &storage.Text{
+		Text:   "Она стала писать о стати",
+		Lemmas: "она стать писать о стать",
+		Tags:   "PRON VERB VERB ADP NOUN",
+	}
+	tests := []struct {
+		name     string
+		text     *storage.Text
+		options  FrequencyOptions
+		wantKeys []string
+		wantSize uint
+	}{
+		{"lemmas", text, FrequencyOptions{},
+			[]string{"она", "стать", "писать", "о", "стать"}, 5},
+		{"cased wordforms", text, FrequencyOptions{Wordforms: true, KeepCase: true},
+			[]string{"Она", "стала", "писать", "о", "стати"}, 5},
+		{"lemmas with pos", text, FrequencyOptions{WithPOS: true},
+			[]string{"она PRON", "стать VERB", "писать VERB", "о ADP", "стать NOUN"}, 5},
+		{"only verbs", text, FrequencyOptions{Wordforms: true, POS: map[string]bool{"VERB": true}},
+			[]string{"", "стала", "писать", "", ""}, 5},
+		{"misaligned tags", &storage.Text{Lemmas: "она стать", Tags: "PRON"}, FrequencyOptions{WithPOS: true},
+			nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, size := frequencyKeys(tt.text, tt.options)
+			if !reflect.DeepEqual(keys, tt.wantKeys) || size != tt.wantSize {
+				t.Errorf("frequencyKeys() = %q, %v, want %q, %v", keys, size, tt.wantKeys, tt.wantSize)
+			}
+		})
+	}
+}
@@ -15,13 +15,23 @@ type Evidence struct {
 type Relation struct {
 	Occured   int        `json:"occured"`
 	Evidences []Evidence `json:"evidences"`
+	// Frequency is the number of times the lemma occurs in the texts
+	Frequency uint `json:"frequency"`
+	// Scores are the association measures with the target, see ScoreRelations
+	Scores AssociationScores `json:"scores"`
 }
 
 const (
-	RELATION_WIDTH = 20
+	// DefaultEvidenceWidth is how many tokens the evidences have on each side
+	DefaultEvidenceWidth = 20
+	// maxEvidences is how many evidences a relation keeps, the rest are only counted
+	maxEvidences = 20
 )
 
-func FindRelations(texts []storage.Text, target string, width int) map[string]*Relation {
+// FindRelations counts the lemmas within width tokens around every
+// occurrence of the target, with sameSentence the window stops at the
+// boundaries of the target's sentence, evidences have context around it
+func FindRelations(texts []storage.Text, target string, width int, sameSentence bool, context ContextWidth) map[string]*Relation {
 	// fullLemas := make([]string, 0, 1000)
 	// for _, v := range texts {
 	// 	fullLemas = append(fullLemas, strings.Split(v.Lemmas, " ")...)
@@ -45,15 +55,25 @@ func FindRelations(texts []storage.Text, target string, width int) map[string]*R
 	for _, text := range texts {
 		readable_texts := strings.Split(text.Text, " ")
 		lemmas := strings.Split(text.Lemmas, " ")
+		var sentences []int
+		if sameSentence {
+			sentences = storage.SentenceIDs(&text, lemmas)
+		}
 		for i, lemma := range lemmas {
-			if lemma != target {
+			// Lemmas should be aligned with the text, but let's not trust it blindly
+			if lemma != target || i >= len(readable_texts) {
 				continue
 			}
 			// Start the width
 			left := utils.Max(0, i-width)
-			right := utils.Min(len(lemmas), i+width)
-			wideLeft := utils.Max(0, i-RELATION_WIDTH)
-			wideRight := utils.Min(len(lemmas), i+RELATION_WIDTH)
+			right := utils.Min(len(lemmas)-1, i+width)
+			for sameSentence && sentences[left] != sentences[i] {
+				left++
+			}
+			for sameSentence && sentences[right] != sentences[i] {
+				right--
+			}
+			wideLeft, wideRight := context.Bounds(readable_texts, i, i+1)
 
 			for j := left; j <= right; j++ {
 				sosed := lemmas[j]
@@ -64,6 +84,9 @@ func FindRelations(texts []storage.Text, target string, width int) map[string]*R
 					}
 				}
 				foundRelations[sosed].Occured++
+				if len(foundRelations[sosed].Evidences) >= maxEvidences {
+					continue
+				}
 				currentContext := strings.Join(readable_texts[wideLeft:wideRight], " ")
 				currentContext = strings.Replace(currentContext, readable_texts[i], "?>"+readable_texts[i]+"<?", 1)
 				currentContext = strings.Replace(currentContext, readable_texts[j], "!>"+readable_texts[j]+"<!", 1)
@@ -77,3 +100,18 @@ func FindRelations(texts []storage.Text, target string, width int) map[string]*R
 	delete(foundRelations, target)
 	return foundRelations
 }
+
+// MergeRelations adds the relations found in another batch of texts to
+// the ones found so far, keeping at most maxEvidences evidences
+func MergeRelations(relations, batch map[string]*Relation) {
+	for lemma, relation := range batch {
+		found, ok := relations[lemma]
+		if !ok {
+			relations[lemma] = relation
+			continue
+		}
+		found.Occured += relation.Occured
+		room := utils.Max(0, maxEvidences-len(found.Evidences))
+		found.Evidences = append(found.Evidences, relation.Evidences[:utils.Min(room, len(relation.Evidences))]...)
+	}
+}
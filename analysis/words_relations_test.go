@@ -0,0 +1,41 @@
+package analysis
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/thecsw/katya/storage"
+)
+
+func TestFindRelations(t *testing.T) {
+	text := storage.Text{
+		Text:   strings.TrimSpace(strings.Repeat("я читаю книгу ", 30)),
+		Lemmas: strings.TrimSpace(strings.Repeat("я читать книга ", 30)),
+	}
+	relations := FindRelations([]storage.Text{text}, "книга", 1, false, ContextWidth{Left: 2, Right: 2})
+	MergeRelations(relations, FindRelations([]storage.Text{text}, "книга", 1, false, ContextWidth{Left: 2, Right: 2}))
+	tests := []struct {
+		name      string
+		lemma     string
+		occured   int
+		evidences int
+	}{
+		{"left", "читать", 60, maxEvidences},
+		{"right", "я", 58, maxEvidences},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			relation, ok := relations[tt.lemma]
+			if !ok {
+				t.Fatalf("FindRelations() has no %q", tt.lemma)
+			}
+			if relation.Occured != tt.occured || len(relation.Evidences) != tt.evidences {
+				t.Errorf("FindRelations() = %d with %d evidences, want %d with %d",
+					relation.Occured, len(relation.Evidences), tt.occured, tt.evidences)
+			}
+		})
+	}
+	if _, ok := relations["книга"]; ok {
+		t.Errorf("FindRelations() has the target itself")
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/thecsw/katya/storage"
+)
+
+const (
+	// collocatesBatchSize is how many texts we walk through at a time for collocates
+	collocatesBatchSize = 200
+	// defaultCollocatesWindow is how many positions we look at on each side
+	defaultCollocatesWindow = 3
+	// maxCollocatesWindow caps the window, as far positions are mostly noise
+	maxCollocatesWindow = 5
+	// defaultCollocatesTop is how many collocates we return per position
+	defaultCollocatesTop = 50
+)
+
+// Collocates is the positional distribution of the words around all the
+// hits of a /find query, like L3 L2 L1 [hit] R1 R2 R3
+type Collocates struct {
+	// Hits is the number of hits the collocates are gathered around
+	Hits uint `json:"hits"`
+	// Layer is the text layer the collocates are taken from
+	Layer string `json:"layer"`
+	// Positions are the collocates at every position from left to right
+	Positions []CollocatePosition `json:"positions"`
+	// Total are the collocates over all the positions together
+	Total []Collocate `json:"total"`
+}
+
+// CollocatePosition are the most frequent collocates at a single position
+type CollocatePosition struct {
+	// Position is like L1 for the word right before the hit or R2 for
+	// the second word after it
+	Position string `json:"position"`
+	// Collocates are the most frequent collocates at the position
+	Collocates []Collocate `json:"collocates"`
+}
+
+// Collocate is a single collocate with the number of times it was seen
+type Collocate struct {
+	// Key is the token of the collocate
+	Key string `json:"key"`
+	// Frequency is how many times it was seen at the position
+	Frequency uint `json:"frequency"`
+}
+
+// findCollocates takes the same query as /find and tabulates the words
+// around its hits by their position, layer= sets the layer of collocates
+// (lemmas by default), window= the number of positions on each side and
+// top= the number of collocates returned per position
+func findCollocates(w http.ResponseWriter, r *http.Request) {
+	// grab the user context from the middleware
+	user := r.Context().Value(ContextKey("user")).(storage.User)
+
+	finder, err := newHitFinder(r, user)
+	if err != nil {
+		httpJSON(w, nil, http.StatusBadRequest, err)
+		return
+	}
+
+	layer := r.URL.Query().Get("layer")
+	if layer == "" {
+		layer = "lemmas"
+	}
+	if _, ok := storage.MapPartToFindFunction[layer]; !ok {
+		httpJSON(w, nil, http.StatusBadRequest, errors.New("bad layer"))
+		return
+	}
+	window := defaultCollocatesWindow
+	if windowT := r.URL.Query().Get("window"); windowT != "" {
+		window, err = strconv.Atoi(windowT)
+		if err != nil || window < 1 || window > maxCollocatesWindow {
+			httpJSON(w, nil, http.StatusBadRequest,
+				errors.Errorf("window has to be between 1 and %d", maxCollocatesWindow))
+			return
+		}
+	}
+	top := defaultCollocatesTop
+	if topT := r.URL.Query().Get("top"); topT != "" {
+		top, err = strconv.Atoi(topT)
+		if err != nil || top < 1 {
+			httpJSON(w, nil, http.StatusBadRequest, errors.New("bad top"))
+			return
+		}
+	}
+
+	result, err := collocatesOf(finder, layer, window, top)
+	if err != nil {
+		httpJSON(w, nil, http.StatusInternalServerError, err)
+		return
+	}
+	httpJSON(w, result, http.StatusOK, nil)
+}
+
+// collocatesOf walks through all the hits of the query and counts the
+// tokens of the layer at every position around them
+func collocatesOf(finder *hitFinder, layer string, window, top int) (*Collocates, error) {
+	// left[k] and right[k] count the tokens k+1 positions away from the hit
+	left := make([]map[string]uint, window)
+	right := make([]map[string]uint, window)
+	for k := 0; k < window; k++ {
+		left[k], right[k] = make(map[string]uint), make(map[string]uint)
+	}
+	total := make(map[string]uint)
+	result := &Collocates{Layer: layer}
+
+	err := finder.walk(collocatesBatchSize, func(hits []textHits) error {
+		for _, v := range hits {
+			if len(v.spans) == 0 {
+				continue
+			}
+			tokens := strings.Split(storage.TextLayers(&v.text)[layer], " ")
+			for _, span := range v.spans {
+				result.Hits++
+				for k := 0; k < window; k++ {
+					// Layers can be misaligned with the text the spans are of
+					if i := span[0] - k - 1; i >= 0 && i < len(tokens) && tokens[i] != "" {
+						term := storage.IndexTerm(layer, tokens[i])
+						left[k][term]++
+						total[term]++
+					}
+					if i := span[1] + k; i < len(tokens) && tokens[i] != "" {
+						term := storage.IndexTerm(layer, tokens[i])
+						right[k][term]++
+						total[term]++
+					}
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.Positions = make([]CollocatePosition, 0, 2*window)
+	for k := window - 1; k >= 0; k-- {
+		result.Positions = append(result.Positions, CollocatePosition{
+			Position:   "L" + strconv.Itoa(k+1),
+			Collocates: topCollocates(left[k], top),
+		})
+	}
+	for k := 0; k < window; k++ {
+		result.Positions = append(result.Positions, CollocatePosition{
+			Position:   "R" + strconv.Itoa(k+1),
+			Collocates: topCollocates(right[k], top),
+		})
+	}
+	result.Total = topCollocates(total, top)
+	return result, nil
+}
+
+// topCollocates returns the top most frequent collocates out of the counts
+func topCollocates(counts map[string]uint, top int) []Collocate {
+	collocates := make([]Collocate, 0, len(counts))
+	for k, v := range counts {
+		collocates = append(collocates, Collocate{Key: k, Frequency: v})
+	}
+	sort.Slice(collocates, func(i, j int) bool {
+		if collocates[i].Frequency != collocates[j].Frequency {
+			return collocates[i].Frequency > collocates[j].Frequency
+		}
+		return collocates[i].Key < collocates[j].Key
+	})
+	if len(collocates) > top {
+		collocates = collocates[:top]
+	}
+	return collocates
+}
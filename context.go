@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/thecsw/katya/analysis"
+)
+
+// newContextWidth reads how wide the contexts around hits are, which is
+// defaultTokens tokens on each side unless context_width= sets both sides,
+// or context_left= and context_right= set them separately, with
+// context_unit=chars the widths are in characters instead of tokens
+func newContextWidth(r *http.Request, defaultTokens int) (analysis.ContextWidth, error) {
+	width := analysis.ContextWidth{Left: defaultTokens, Right: defaultTokens}
+	switch r.URL.Query().Get("context_unit") {
+	case "", "tokens":
+	case "chars":
+		width = analysis.ContextWidth{
+			Left:  analysis.DefaultContextChars,
+			Right: analysis.DefaultContextChars,
+			Chars: true,
+		}
+	default:
+		return width, errors.New("bad context_unit")
+	}
+	for _, side := range []struct {
+		param string
+		value []*int
+	}{
+		{"context_width", []*int{&width.Left, &width.Right}},
+		{"context_left", []*int{&width.Left}},
+		{"context_right", []*int{&width.Right}},
+	} {
+		valueT := r.URL.Query().Get(side.param)
+		if valueT == "" {
+			continue
+		}
+		value, err := strconv.Atoi(valueT)
+		if err != nil {
+			return width, errors.Errorf("bad %s", side.param)
+		}
+		for _, v := range side.value {
+			*v = value
+		}
+	}
+	return width, width.Validate()
+}
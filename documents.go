@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/thecsw/katya/analysis"
+	"github.com/thecsw/katya/storage"
+)
+
+const (
+	// defaultDocumentsLimit is how many documents we return by default
+	defaultDocumentsLimit = 20
+	// maxDocumentsLimit is the most documents one can ask for at once
+	maxDocumentsLimit = 100
+)
+
+// Documents is a page of texts ranked by the query
+type Documents struct {
+	// Total is the number of all the texts that matched the query
+	Total int `json:"total"`
+	// Documents are the texts of the page from the best one
+	Documents []analysis.Document `json:"documents"`
+}
+
+// documentsFinder ranks the texts of the given sources (see newScope) by
+// how much they are about the lemmas of query=, limit= and offset= page
+// through them, see analysis.SearchDocuments
+func documentsFinder(w http.ResponseWriter, r *http.Request) {
+	// grab the user context from the middleware
+	user := r.Context().Value(ContextKey("user")).(storage.User)
+	scope, err := newScope(r, user)
+	if err != nil {
+		httpJSON(w, nil, http.StatusBadRequest, err)
+		return
+	}
+	query := r.URL.Query().Get("query")
+	if query == "" {
+		httpJSON(w, nil, http.StatusBadRequest, errors.New("bad query"))
+		return
+	}
+	limit := defaultDocumentsLimit
+	if limitT := r.URL.Query().Get("limit"); limitT != "" {
+		limit, err = strconv.Atoi(limitT)
+		if err != nil || limit < 1 || limit > maxDocumentsLimit {
+			httpJSON(w, nil, http.StatusBadRequest, errors.New("bad limit"))
+			return
+		}
+	}
+	offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	documents, total, err := analysis.SearchDocuments(scope, query, limit, offset)
+	if err != nil {
+		httpJSON(w, nil, http.StatusInternalServerError, errors.Wrap(err, "failed to search documents"))
+		return
+	}
+	httpJSON(w, Documents{Total: total, Documents: documents}, http.StatusOK, nil)
+}
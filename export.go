@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/thecsw/katya/log"
+)
+
+const (
+	// exportBatchSize is how many texts we walk through at a time in exports
+	exportBatchSize = 100
+	// exportBatchTimeout is how long we let a single batch take to be written,
+	// it replaces the server's write timeout, which would kill long exports
+	exportBatchTimeout = 30 * time.Second
+)
+
+// writeDeadliner is a response writer that lets us move its write deadline,
+// net/http's own writer does since go 1.20, older ones just skip it
+type writeDeadliner interface {
+	SetWriteDeadline(deadline time.Time) error
+}
+
+var (
+	// exportFormats maps the export formats to their content types
+	exportFormats = map[string]string{
+		"csv":    "application/csv",
+		"ndjson": "application/x-ndjson",
+	}
+)
+
+// exportHits streams every single hit of the query, walking through all
+// the matched texts in batches and flushing the rows after every batch
+func exportHits(w http.ResponseWriter, r *http.Request, finder *hitFinder, format string) {
+	// Sorted and sampled exports have to know about all the hits before
+	// writing any, so they can still fail with a proper status
+	var refs []hitRef
+	if finder.ordered() {
+		var err error
+		refs, err = finder.orderedHits()
+		if err == errTooManyHits {
+			httpJSON(w, nil, http.StatusBadRequest, err)
+			return
+		}
+		if err != nil {
+			httpJSON(w, nil, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	flusher, canFlush := w.(http.Flusher)
+	deadliner, canExtend := w.(writeDeadliner)
+	w.Header().Set("Content-Type", exportFormats[format])
+	w.Header().Set("Content-Disposition", `attachment; filename="katya-export.`+format+`"`)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	columns := finder.csvColumns()
+	csvWriter := csv.NewWriter(w)
+	jsonEncoder := json.NewEncoder(w)
+	if format == "csv" {
+		_ = csvWriter.Write(csvFindHeader(columns))
+	}
+
+	thisParams := log.Params{"user": finder.user.Name, "query": finder.query, "format": format}
+	exported := 0
+	// writeBatch writes a batch of results and flushes them to the client
+	writeBatch := func(results []SearchResult) error {
+		// Stop if the client has given up on us
+		if err := r.Context().Err(); err != nil {
+			return err
+		}
+		// Give every batch its own time to be written
+		if canExtend {
+			if err := deadliner.SetWriteDeadline(time.Now().Add(exportBatchTimeout)); err != nil {
+				log.Error("Failed to extend the export deadline", err, thisParams)
+			}
+		}
+		for _, result := range results {
+			var err error
+			if format == "csv" {
+				err = csvWriter.Write(csvFindRow(result, columns))
+			} else {
+				err = jsonEncoder.Encode(result)
+			}
+			if err != nil {
+				return err
+			}
+			exported++
+		}
+		csvWriter.Flush()
+		if err := csvWriter.Error(); err != nil {
+			return err
+		}
+		if canFlush {
+			flusher.Flush()
+		}
+		return nil
+	}
+
+	var err error
+	if finder.ordered() {
+		err = finder.walkOrdered(refs, exportBatchSize, writeBatch)
+	} else {
+		err = finder.walk(exportBatchSize, func(hits []textHits) error {
+			results := make([]SearchResult, 0, len(hits))
+			for _, v := range hits {
+				textSplit := strings.Split(v.text.Text, " ")
+				layersSplit := finder.splitLayers(v.text)
+				for _, span := range v.spans {
+					results = append(results, finder.result(v.text, textSplit, layersSplit, span[0], span[1]))
+				}
+			}
+			return writeBatch(results)
+		})
+	}
+	thisParams["exported"] = exported
+	if err != nil {
+		// The status is already sent, so the best we can do is to log it
+		log.Error("Failed exporting search results", err, thisParams)
+		return
+	}
+	log.Format("Successfully exported search results", thisParams)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/thecsw/katya/storage"
+)
+
+const (
+	// statsBatchSize is how many texts we walk through at a time for stats
+	statsBatchSize = 200
+)
+
+// FindStats is the distribution of all the hits of a /find query
+type FindStats struct {
+	// Hits is the total number of hits
+	Hits uint `json:"hits"`
+	// Texts is the number of texts with at least one hit
+	Texts uint `json:"texts"`
+	// Sources is the breakdown of hits per searched source
+	Sources []SourceStats `json:"sources"`
+}
+
+// SourceStats is the distribution of hits in a single source
+type SourceStats struct {
+	// Link is the starting link of the source
+	Link string `json:"link"`
+	// Label is the user-given label of the source
+	Label string `json:"label"`
+	// Hits is the number of hits in the source
+	Hits uint `json:"hits"`
+	// Texts is the number of texts in the source with at least one hit
+	Texts uint `json:"texts"`
+	// NumWords is the size of the source in words
+	NumWords uint `json:"num_words"`
+	// IPM is the number of hits per million words of the source
+	IPM float64 `json:"ipm"`
+}
+
+// findStats walks through all the hits of the query and tallies them up
+// per source, a text linked to multiple sources counts towards each of them
+func findStats(finder *hitFinder) (*FindStats, error) {
+	sources, err := storage.GetScopeSources(finder.scope)
+	if err != nil {
+		return nil, err
+	}
+	stats := &FindStats{Sources: make([]SourceStats, 0, len(sources))}
+	bySource := make(map[uint]*SourceStats, len(sources))
+	for _, source := range sources {
+		stats.Sources = append(stats.Sources, SourceStats{
+			Link:     source.Link,
+			Label:    source.Label,
+			NumWords: source.NumWords,
+		})
+	}
+	for i, source := range sources {
+		bySource[source.ID] = &stats.Sources[i]
+	}
+
+	err = finder.walk(statsBatchSize, func(hits []textHits) error {
+		textHitsNum := make(map[uint]uint, len(hits))
+		textIDs := make([]uint, 0, len(hits))
+		for _, v := range hits {
+			if len(v.spans) == 0 {
+				continue
+			}
+			textHitsNum[v.text.ID] = uint(len(v.spans))
+			textIDs = append(textIDs, v.text.ID)
+			stats.Hits += uint(len(v.spans))
+			stats.Texts++
+		}
+		links, err := storage.GetTextsSourcesInScope(finder.scope, textIDs)
+		if err != nil {
+			return err
+		}
+		for _, link := range links {
+			if source, ok := bySource[link.SourceID]; ok {
+				source.Hits += textHitsNum[link.TextID]
+				source.Texts++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, source := range stats.Sources {
+		if source.NumWords > 0 {
+			stats.Sources[i].IPM = float64(source.Hits) / float64(source.NumWords) * 1e6
+		}
+	}
+	sort.SliceStable(stats.Sources, func(i, j int) bool {
+		return stats.Sources[i].Hits > stats.Sources[j].Hits
+	})
+	return stats, nil
+}
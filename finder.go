@@ -8,17 +8,32 @@ import (
 
 	"github.com/pkg/errors"
 
+	"github.com/thecsw/katya/analysis"
 	"github.com/thecsw/katya/storage"
 	"github.com/thecsw/katya/utils"
 )
 
 const (
-	// searchResultWidth tells us how many left-right tokens we
-	// pad the center search results with
-	searchResultWidth = 37
-	// limitPerSource tells us how many results we will have at
-	// max for each source that we find
-	limitPerSource = 10
+	// defaultSearchResultWidth tells us how many left-right tokens we
+	// pad the center search results with, see newContextWidth
+	defaultSearchResultWidth = 37
+	// defaultHitsPerText tells us how many results we will have at
+	// max for each text that we find on a page
+	defaultHitsPerText = 10
+	// maxHitsPerText is the most results per text one can ask for
+	maxHitsPerText = 100
+	// maxContextSentences is how many sentences around the hit's own
+	// sentence a sentence context can have on each side
+	maxContextSentences = 1
+)
+
+var (
+	// annotationLayers are the text layers that can be attached to the results
+	annotationLayers = map[string]bool{
+		"tags":   true,
+		"lemmas": true,
+		"shapes": true,
+	}
 )
 
 // SearchResult is the struct where we store the results
@@ -39,40 +54,68 @@ type SearchResult struct {
 	Title string `json:"title"`
 	// Scraped stores the date of when the page was scraped
 	Scraped string `json:"scraped"`
+	// Layers are the requested annotation layers of the contexts
+	Layers map[string]SearchResultLayer `json:"layers,omitempty"`
+	// Highlights are the offsets of the center tokens that matched a boolean
+	// query, as its center also has the tokens between the matched ones
+	Highlights []int `json:"highlights,omitempty"`
+	// Variant is the variant of the query a fuzzy search matched
+	Variant string `json:"variant,omitempty"`
+}
+
+// SearchResultLayer stores the per-token annotations of a single layer
+// (tags, lemmas or shapes) that are aligned with the result's contexts
+type SearchResultLayer struct {
+	// Left is the annotation of the left context
+	Left []string `json:"left"`
+	// Center is the annotation of the central context
+	Center []string `json:"center"`
+	// Right is the annotation of the right context
+	Right []string `json:"right"`
 }
 
 // findQueryInTexts takes /api/find query and returns a SearchResult slice
 func findQueryInTexts(w http.ResponseWriter, r *http.Request) {
-	// Get the actual search query, this is mission critical
-	query := r.URL.Query().Get("query")
-	if query == "" {
-		httpJSON(w, nil, http.StatusBadRequest, errors.New("bad query"))
-		return
-	}
 	// grab the user context from the middleware
 	user := r.Context().Value(ContextKey("user")).(storage.User)
 
-	// partLookup specifies what part of the text is matched against the query
-	// possible options are:
-	//   - text: actual simple extracted text that's tokenized (spaces around PUNCT)
-	//   - tags: tagged results, allows searching for like "NOUN PART VERB VERB"
-	//   - shapes: just shapes like "Xxx xxxx - xx xxxx - x ?" -> "Это всемирную - то историю - с ?"
-	//   - lemmas: lemmas will take in a nominative case of a word and search for all its
-	//             conjugations, such that a search for a nominative word of "полюбить" will
-	//             automatically search for "полюбил" or "полюбить" or "полюбили". Pretty coll!
-	partLookup := r.URL.Query().Get("part")
+	// Parse the actual search query, this is mission critical
+	finder, err := newHitFinder(r, user)
+	if err != nil {
+		httpJSON(w, nil, http.StatusBadRequest, err)
+		return
+	}
+
 	// whether we should serve a CSV file instead of a JSON
 	useCSV := r.URL.Query().Get("csv")
 	// how many results do we want to show
 	limitString := r.URL.Query().Get("limit")
 	// the offset to pass to the DB for results
 	offsetString := r.URL.Query().Get("offset")
-	// whether we should care for casing in DB string match
-	caseSensitive := r.URL.Query().Get("case_sensitive")
+	// whether we should stream all the hits as csv or ndjson instead
+	export := r.URL.Query().Get("export")
+	// whether we should return the hits distribution instead of the hits
+	stats := r.URL.Query().Get("stats")
 
-	// Fallback to a by-text lookup if not given or bad
-	if _, ok := storage.MapPartToFindFunction[partLookup]; !ok {
-		partLookup = "text"
+	// Stats also walk through every single hit, but only count them
+	if stats == "1" {
+		result, err := findStats(finder)
+		if err != nil {
+			httpJSON(w, nil, http.StatusInternalServerError, err)
+			return
+		}
+		httpJSON(w, result, http.StatusOK, nil)
+		return
+	}
+
+	// Exports walk through every single hit, so they don't need pagination
+	if export != "" {
+		if _, ok := exportFormats[export]; !ok {
+			httpJSON(w, nil, http.StatusBadRequest, errors.New("bad export format"))
+			return
+		}
+		exportHits(w, r, finder, export)
+		return
 	}
 
 	// Convert limit to int, fallback to 100
@@ -87,114 +130,630 @@ func findQueryInTexts(w http.ResponseWriter, r *http.Request) {
 		offset = 0
 	}
 
-	// Find all the matches from the database by doing a string sub-match search
-	resultsDB, err := storage.MapPartToFindFunction[partLookup](user.ID, query, limit, offset, caseSensitive == "1")
+	// Sorted or sampled results are paginated by hits after collecting all of them
+	if finder.ordered() {
+		refs, err := finder.orderedHits()
+		if err == errTooManyHits {
+			httpJSON(w, nil, http.StatusBadRequest, err)
+			return
+		}
+		if err != nil {
+			httpJSON(w, nil, http.StatusInternalServerError, err)
+			return
+		}
+		refs = refs[utils.Min(offset, len(refs)):utils.Min(offset+limit, len(refs))]
+		results, err := finder.resultsOf(refs)
+		if err != nil {
+			httpJSON(w, nil, http.StatusInternalServerError, err)
+			return
+		}
+		if len(results) == 0 && offset == 0 {
+			suggestQuery(w, finder)
+		}
+		httpFindResults(w, results, finder.csvColumns(), useCSV == "1")
+		return
+	}
+
+	// Find all the matches from the database
+	hits, err := finder.page(limit, offset)
 	if err != nil {
 		httpJSON(w, nil, http.StatusInternalServerError, err)
 		return
 	}
 
 	// Create the final object we will be serving through the API
-	results := make([]SearchResult, 0, len(resultsDB))
-	for _, v := range resultsDB {
+	results := make([]SearchResult, 0, len(hits))
+	for _, v := range hits {
+		textSplit := strings.Split(v.text.Text, " ")
+		layersSplit := finder.splitLayers(v.text)
+		// File every match in the found text in its own result case
+		for _, span := range v.spans[:utils.Min(finder.hitsPerText, len(v.spans))] {
+			results = append(results, finder.result(v.text, textSplit, layersSplit, span[0], span[1]))
+		}
+	}
+
+	// Suggest a spelling right away if the query found nothing at all
+	if len(results) == 0 && offset == 0 {
+		suggestQuery(w, finder)
+	}
+
+	httpFindResults(w, results, finder.csvColumns(), useCSV == "1")
+}
+
+// httpFindResults serves the search results either as a CSV or a JSON
+func httpFindResults(w http.ResponseWriter, results []SearchResult, columns csvFindColumns, useCSV bool) {
+	// Override the serving into the CSV serving function
+	if useCSV {
+		httpCSVFindResults(w, results, columns, http.StatusOK)
+		return
+	}
+
+	// Fallback to the default JSON return
+	httpJSON(w, results, http.StatusOK, nil)
+}
 
-		// This map allows us to dynamically choose the text part that we used for DB string search
-		whatToSearchIn := map[string]string{
-			"text":   v.Text,
-			"shapes": v.Shapes,
-			"tags":   v.Tags,
-			"lemmas": v.Lemmas,
+// textHits stores the [start, end) token spans of every hit in a text
+type textHits struct {
+	text  storage.Text
+	spans [][2]int
+}
+
+// hitFinder finds the hits of a single /find query page by page
+type hitFinder struct {
+	// user is the one whose sources we search
+	user storage.User
+	// scope narrows down the user's sources and texts for this query
+	scope storage.Scope
+	// part is the text part that is matched against the query
+	part string
+	// query is the raw search query
+	query string
+	// caseSensitive tells whether we care for casing in the match
+	caseSensitive bool
+	// substring does a raw substring match instead of going through the index
+	substring bool
+	// strict disables the orthographic normalization, so ё and е differ
+	strict bool
+	// fuzzy is the edit distance query words can match tokens within
+	fuzzy int
+	// transpositions counts swapped adjacent letters as a single edit
+	transpositions bool
+	// cql is the parsed query if the part is cql
+	cql *analysis.CQLQuery
+	// boolean is the parsed query if the part is bool
+	boolean *analysis.BoolQuery
+	// regex is the compiled query if we do a regular expression search
+	regex *utils.UnicodeRegexp
+	// layers are the annotation layers to return with the results
+	layers []string
+	// sortBy is the key all the hits are sorted by, see sortKeys
+	sortBy string
+	// sample is the number of hits to randomly draw, 0 means all of them
+	sample int
+	// seed is the random seed of the sample
+	seed int64
+	// width is how wide the contexts around the hits are
+	width analysis.ContextWidth
+	// hitsPerText is how many hits of a single text a page shows
+	hitsPerText int
+	// sentenceContext cuts the contexts at the sentence boundaries instead
+	// of width around the hit
+	sentenceContext bool
+	// contextSentences is how many more sentences a sentence context has
+	// on each side of the hit's own sentences
+	contextSentences int
+
+	// starts caches the index matches between the pages
+	starts map[uint][]int
+	// textIDs are the sorted text IDs of starts we paginate over
+	textIDs []uint
+	// boolMatches caches the boolean query matches of the last matched text
+	boolMatches []analysis.BoolMatch
+	// boolTextID is the text boolMatches are of
+	boolTextID uint
+	// sentenceIDs caches the sentence numbers of the last text's tokens
+	sentenceIDs []int
+	// sentenceTextID is the text sentenceIDs are of
+	sentenceTextID uint
+	// partSplit caches the searched part tokens of the last text
+	partSplit []string
+	// partTextID is the text partSplit is of
+	partTextID uint
+}
+
+// newHitFinder creates a hit finder out of the /find query parameters
+func newHitFinder(r *http.Request, user storage.User) (*hitFinder, error) {
+	query := r.URL.Query().Get("query")
+	if query == "" {
+		return nil, errors.New("bad query")
+	}
+	scope, err := newScope(r, user)
+	if err != nil {
+		return nil, err
+	}
+	finder := &hitFinder{
+		user:  user,
+		scope: scope,
+		query: query,
+		// partLookup specifies what part of the text is matched against the query, queries
+		// are matched as whole tokens through the inverted index unless substring=1 is given,
+		// possible options are:
+		//   - text: actual simple extracted text that's tokenized (spaces around PUNCT)
+		//   - tags: tagged results, allows searching for like "NOUN PART VERB VERB"
+		//   - shapes: just shapes like "Xxx xxxx - xx xxxx - x ?" -> "Это всемирную - то историю - с ?"
+		//   - lemmas: lemmas will take in a nominative case of a word and search for all its
+		//             conjugations, such that a search for a nominative word of "полюбить" will
+		//             automatically search for "полюбил" or "полюбить" or "полюбили". Pretty coll!
+		//   - cql: a token-level corpus query, where every token can constrain multiple parts
+		//          at once, like [lemma="любить" & tag="VERB"] [tag="ADJ"]? [tag="NOUN"]
+		//   - bool: a co-occurrence query of lemmas (or word:forms) with AND, OR, NOT and
+		//           NEAR/n or SENT proximities, like книга NEAR/5 полка NOT SENT стол
+		// any part other than cql can also be searched with a regular expression, when
+		// regex=1 is given, like \w+ость\b to find a whole family of suffixes
+		part:          r.URL.Query().Get("part"),
+		caseSensitive: r.URL.Query().Get("case_sensitive") == "1",
+		substring:     r.URL.Query().Get("substring") == "1",
+		strict:        r.URL.Query().Get("strict") == "1",
+		sortBy:        r.URL.Query().Get("sort"),
+	}
+
+	// Unless strict=1 is given, ё matches е and stress marks or soft hyphens are
+	// ignored, so the query is normalized the same way the texts are
+	if !finder.strict {
+		finder.query = utils.NormalizeRussian(query)
+	}
+
+	// Sorting goes over the full set of hits, so it has to be a known key
+	if _, ok := sortKeys[finder.sortBy]; finder.sortBy != "" && !ok {
+		return nil, errors.New("bad sort")
+	}
+
+	// Sampling draws from the full set of hits, deterministic for the same seed
+	if sample := r.URL.Query().Get("sample"); sample != "" {
+		var err error
+		finder.sample, err = strconv.Atoi(sample)
+		if err != nil || finder.sample < 1 || finder.sample > maxSampleSize {
+			return nil, errors.Errorf("sample has to be between 1 and %d", maxSampleSize)
+		}
+	}
+	if seed := r.URL.Query().Get("seed"); seed != "" {
+		var err error
+		finder.seed, err = strconv.ParseInt(seed, 10, 64)
+		if err != nil {
+			return nil, errors.New("bad seed")
 		}
+	}
 
-		// Try to find all indices of this substring in the text to later map it to token indices
-		matches := utils.StringsIndexMultiple(whatToSearchIn[partLookup], query, caseSensitive == "1")
+	// Contexts are defaultSearchResultWidth tokens around the hit unless set otherwise,
+	// or unless context=sentence is given, which gives the hit's whole sentence, with
+	// context_sentences=1 also the sentence before and after it
+	finder.width, err = newContextWidth(r, defaultSearchResultWidth)
+	if err != nil {
+		return nil, err
+	}
+	switch r.URL.Query().Get("context") {
+	case "", "tokens":
+	case "sentence":
+		finder.sentenceContext = true
+	default:
+		return nil, errors.New("bad context")
+	}
+	if contextSentences := r.URL.Query().Get("context_sentences"); contextSentences != "" {
+		var err error
+		finder.contextSentences, err = strconv.Atoi(contextSentences)
+		if err != nil || finder.contextSentences < 0 || finder.contextSentences > maxContextSentences {
+			return nil, errors.Errorf("context_sentences has to be between 0 and %d", maxContextSentences)
+		}
+	}
 
-		// If there are no matches found (DB lied???) then we skip this
-		if len(matches) < 1 {
-			continue
+	// Pages show only so many hits of a single text, like per_text=3
+	finder.hitsPerText = defaultHitsPerText
+	if perText := r.URL.Query().Get("per_text"); perText != "" {
+		finder.hitsPerText, err = strconv.Atoi(perText)
+		if err != nil || finder.hitsPerText < 1 || finder.hitsPerText > maxHitsPerText {
+			return nil, errors.Errorf("per_text has to be between 1 and %d", maxHitsPerText)
 		}
+	}
 
-		// Split the text sections into the actual token slice
-		textSplit := strings.Split(v.Text, " ")
-		tagsSplit := strings.Split(v.Tags, " ")
-		shapesSplit := strings.Split(v.Shapes, " ")
-		lemmasSplit := strings.Split(v.Lemmas, " ")
+	// Annotation layers that should come with every context, like layers=tags,lemmas
+	if layers := r.URL.Query().Get("layers"); layers != "" {
+		seen := make(map[string]bool)
+		for _, layer := range strings.Split(layers, ",") {
+			layer = strings.TrimSpace(layer)
+			if !annotationLayers[layer] {
+				return nil, errors.Errorf("bad layer %q", layer)
+			}
+			if !seen[layer] {
+				finder.layers = append(finder.layers, layer)
+				seen[layer] = true
+			}
+		}
+	}
 
-		// File every match in the found text in its own result case
-		for _, index := range matches[:utils.Min(limitPerSource, len(matches))] {
+	// CQL queries are matched token by token instead of a string sub-match
+	if finder.part == "cql" {
+		cql, err := analysis.ParseCQL(finder.query, finder.caseSensitive)
+		if err != nil {
+			return nil, errors.Wrap(err, "bad cql query")
+		}
+		finder.cql = cql
+		return finder, nil
+	}
+
+	// Boolean queries are matched over the whole text instead of a sequence
+	if finder.part == "bool" {
+		boolean, err := analysis.ParseBoolQuery(finder.query, finder.strict)
+		if err != nil {
+			return nil, errors.Wrap(err, "bad boolean query")
+		}
+		finder.boolean = boolean
+		return finder, nil
+	}
+
+	// Fallback to a by-text lookup if not given or bad
+	if _, ok := storage.MapPartToFindFunction[finder.part]; !ok {
+		finder.part = "text"
+	}
+
+	// Regular expressions find the hits themselves instead of substrings
+	if r.URL.Query().Get("regex") == "1" {
+		regex, err := utils.CompileUnicodeRegexp(finder.query, finder.caseSensitive)
+		if err != nil {
+			return nil, errors.Wrap(err, "bad regular expression")
+		}
+		finder.regex = regex
+	}
+
+	// Fuzzy searches expand the query words into the close words of the vocabulary,
+	// like fuzzy=1, with transpositions=1 swapped letters are a single edit
+	if fuzzy := r.URL.Query().Get("fuzzy"); fuzzy != "" {
+		finder.fuzzy, err = strconv.Atoi(fuzzy)
+		if err != nil || finder.fuzzy < 0 || finder.fuzzy > analysis.MaxFuzzyDistance {
+			return nil, errors.Errorf("fuzzy has to be between 0 and %d", analysis.MaxFuzzyDistance)
+		}
+		finder.transpositions = r.URL.Query().Get("transpositions") == "1"
+	}
+	if finder.fuzzy > 0 && (finder.substring || finder.regex != nil || !isVocabularyLayer(finder.part)) {
+		return nil, errors.New("fuzzy only searches whole words of text or lemmas")
+	}
+	return finder, nil
+}
+
+// csvColumns returns the columns the CSV files of the query's results have
+func (f *hitFinder) csvColumns() csvFindColumns {
+	return csvFindColumns{layers: f.layers, variant: f.fuzzy > 0, highlights: f.boolean != nil}
+}
+
+// splitLayers splits the requested annotation layers of a text into tokens
+func (f *hitFinder) splitLayers(v storage.Text) map[string][]string {
+	if len(f.layers) == 0 {
+		return nil
+	}
+	layers := storage.TextLayers(&v)
+	layersSplit := make(map[string][]string, len(f.layers))
+	for _, layer := range f.layers {
+		layersSplit[layer] = strings.Split(layers[layer], " ")
+	}
+	return layersSplit
+}
+
+// normalized tells whether a part is searched with its orthography normalized
+func (f *hitFinder) normalized(part string) bool {
+	_, ok := storage.MapNormalizedPartToFindFunction[part]
+	return ok && !f.strict
+}
+
+// searchLayers returns the layers of a text that the query is matched
+// against, they are normalized unless strict=1, but stay token aligned
+func (f *hitFinder) searchLayers(v *storage.Text) map[string]string {
+	layers := storage.TextLayers(v)
+	for part := range layers {
+		if f.normalized(part) {
+			layers[part] = utils.NormalizeRussian(layers[part])
+		}
+	}
+	return layers
+}
+
+// page returns the hits of the query in a page of texts, a text
+// without any hits is still returned with empty spans
+func (f *hitFinder) page(limit, offset int) ([]textHits, error) {
+	texts, err := f.texts(limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	hits := make([]textHits, len(texts))
+	for i, v := range texts {
+		hits[i] = textHits{text: v, spans: f.match(v)}
+	}
+	return hits, nil
+}
+
+// walk goes through every matched text of the query in batches, texts come
+// ordered by their IDs, so a text linked to multiple enabled sources is skipped
+// after its first appearance to not count its hits twice
+func (f *hitFinder) walk(batchSize int, fn func(hits []textHits) error) error {
+	lastTextID := uint(0)
+	for offset := 0; ; offset += batchSize {
+		hits, err := f.page(batchSize, offset)
+		if err != nil {
+			return err
+		}
+		unique := make([]textHits, 0, len(hits))
+		for _, v := range hits {
+			if v.text.ID != lastTextID {
+				unique = append(unique, v)
+			}
+			lastTextID = v.text.ID
+		}
+		if err := fn(unique); err != nil {
+			return err
+		}
+		// A short page means there are no more texts to go through
+		if len(hits) < batchSize {
+			return nil
+		}
+	}
+}
+
+// indexed returns the part and the terms to look up in the inverted index,
+// ok is false if the query can only be resolved by a database search
+func (f *hitFinder) indexed() (part string, terms []string, ok bool) {
+	if f.cql != nil {
+		// Any whole token every match has to contain narrows the texts down
+		part, literal, ok := f.cql.Literal()
+		return part, []string{storage.IndexTerm(part, literal)}, ok
+	}
+	if f.boolean != nil {
+		part, term, ok := f.boolean.Literal()
+		return part, []string{term}, ok
+	}
+	if f.substring || f.regex != nil {
+		return "", nil, false
+	}
+	tokens := strings.Fields(f.query)
+	terms = make([]string, len(tokens))
+	for i, token := range tokens {
+		terms[i] = storage.IndexTerm(f.part, token)
+	}
+	return f.part, terms, true
+}
+
+// texts returns a page of texts that can have hits of the query
+func (f *hitFinder) texts(limit, offset int) ([]storage.Text, error) {
+	// Regular expressions are first matched by the database to find the texts
+	if f.regex != nil {
+		pattern := utils.RegexForPostgres(f.query)
+		return storage.FindPartRegexInScope(f.part, f.scope, pattern, limit, offset,
+			f.caseSensitive, f.normalized(f.part))
+	}
+	part, terms, ok := f.indexed()
+	if !ok {
+		// A CQL or boolean query without a whole token has to check all
+		// the texts, which an empty substring will match
+		part, query := f.part, f.query
+		if f.cql != nil || f.boolean != nil {
+			part, query = "text", ""
+		}
+		if f.normalized(part) {
+			return storage.MapNormalizedPartToFindFunction[part](f.scope, query, limit, offset, f.caseSensitive)
+		}
+		return storage.MapPartToFindFunction[part](f.scope, query, limit, offset, f.caseSensitive)
+	}
+	if f.starts == nil {
+		// Fuzzy searches look up every close variant of every query word
+		variants := make([][]string, len(terms))
+		for i, term := range terms {
+			variants[i] = []string{term}
+		}
+		if f.fuzzy > 0 {
+			var err error
+			variants, err = analysis.ExpandFuzzy(f.scope, part, terms, f.fuzzy, f.transpositions)
+			if err != nil {
+				return nil, err
+			}
+		}
+		starts, err := storage.FindVariantPhraseStartsInScope(part, f.scope, variants)
+		if err != nil {
+			return nil, err
+		}
+		f.starts, f.textIDs = starts, storage.SortedTextIDs(starts)
+	}
+	if offset >= len(f.textIDs) {
+		return []storage.Text{}, nil
+	}
+	return storage.GetTextsByIDs(f.textIDs[offset:utils.Min(len(f.textIDs), offset+limit)])
+}
+
+// match finds all the hits of the query in a single text
+func (f *hitFinder) match(v storage.Text) [][2]int {
+	layers := f.searchLayers(&v)
+	if f.cql != nil {
+		layersSplit := make(map[string][]string, len(layers))
+		for part, layer := range layers {
+			layersSplit[part] = strings.Split(layer, " ")
+		}
+		return f.cql.Match(layersSplit)
+	}
+	if f.boolean != nil {
+		layersSplit := make(map[string][]string, len(layers))
+		for part, layer := range layers {
+			layersSplit[part] = strings.Split(layer, " ")
+		}
+		sentences := storage.SentenceIDs(&v, layersSplit["text"])
+		f.boolMatches, f.boolTextID = f.boolean.Match(layersSplit, sentences), v.ID
+		spans := make([][2]int, len(f.boolMatches))
+		for i, match := range f.boolMatches {
+			spans[i] = match.Span
+		}
+		return spans
+	}
+	partSplit := strings.Split(layers[f.part], " ")
+	spans := make([][2]int, 0)
+
+	if f.regex != nil {
+		// Matches have variable lengths, so both of their ends are mapped to tokens,
+		// the last byte of a match tells us the last token it touches
+		for _, match := range f.regex.FindAllIndex(layers[f.part]) {
+			start := utils.FindTokenIndex(partSplit, match[0])
+			end := utils.FindTokenIndex(partSplit, match[1]-1) + 1
+			if start < 0 || end <= start {
+				continue
+			}
+			spans = append(spans, [2]int{start, end})
+		}
+		return spans
+	}
+
+	if f.substring {
+		// Try to find all indices of this substring in the text to later map it to token indices
+		matches := utils.StringsIndexMultiple(layers[f.part], f.query, f.caseSensitive)
+		for _, index := range matches {
 			// If we hit a bad index, skip and continue
 			if index < 1 {
 				continue
 			}
+			// Map the actual found query's index into the token index
+			spans = append(spans, [2]int{
+				utils.FindTokenIndex(partSplit, index),
+				utils.FindTokenIndex(partSplit, index+len(f.query)) + 1,
+			})
+		}
+		return spans
+	}
 
-			// this maps what token split we will be using for mapping the index to token index
-			whereToFindTheTokenIndex := map[string][]string{
-				"text":   textSplit,
-				"shapes": shapesSplit,
-				"tags":   tagsSplit,
-				"lemmas": lemmasSplit,
-			}
+	tokens := strings.Fields(f.query)
+	for _, start := range f.starts[v.ID] {
+		end := start + len(tokens)
+		if end > len(partSplit) {
+			break
+		}
+		// The index ignores casing and orthography, so check them ourselves if needed,
+		// fuzzy matches are different tokens to begin with
+		if (f.caseSensitive || f.strict) && f.fuzzy == 0 && !f.sameTokens(partSplit[start:end], tokens) {
+			continue
+		}
+		spans = append(spans, [2]int{start, end})
+	}
+	return spans
+}
 
-			// Map the actual found query's index into the token index
-			resultsSplitLeftIndex := utils.FindTokenIndex(whereToFindTheTokenIndex[partLookup], index)
-			resultsSplitRightIndex := utils.FindTokenIndex(whereToFindTheTokenIndex[partLookup], index+len(query)) + 1
-
-			// Find the indices that we will split the tokens from left to right
-			leftSplitLeftIndex := utils.Max(0, resultsSplitLeftIndex-searchResultWidth)
-			leftSplitRightIndex := resultsSplitLeftIndex
-			centerSplitLeftIndex := resultsSplitLeftIndex
-			centerSplitRightIndex := resultsSplitRightIndex
-			rightSplitLeftIndex := resultsSplitRightIndex
-			rightSplitRightIndex := utils.Min(len(textSplit), resultsSplitRightIndex+searchResultWidth)
-
-			// Split the text tokens into the results section
-			leftTextSplit := textSplit[leftSplitLeftIndex:leftSplitRightIndex]
-			centerTextSplit := textSplit[centerSplitLeftIndex:centerSplitRightIndex]
-			rightTextSplit := textSplit[rightSplitLeftIndex:rightSplitRightIndex]
-
-			// // Split the tags tokens into the results section
-			// leftTagsSplit := tagsSplit[leftSplitLeftIndex:leftSplitRightIndex]
-			// centerTagsSplit := tagsSplit[centerSplitLeftIndex:centerSplitRightIndex]
-			// rightTagsSplit := tagsSplit[rightSplitLeftIndex:rightSplitRightIndex]
-
-			// // Split the shapes tokens into the results section
-			// leftShapesSplit := shapesSplit[leftSplitLeftIndex:leftSplitRightIndex]
-			// centerShapesSplit := shapesSplit[centerSplitLeftIndex:centerSplitRightIndex]
-			// rightShapesSplit := shapesSplit[rightSplitLeftIndex:rightSplitRightIndex]
-
-			// // Split the nominative tokens into the results section
-			// leftNominativesSplit := lemmasSplit[leftSplitLeftIndex:leftSplitRightIndex]
-			// centerNominativesSplit := lemmasSplit[centerSplitLeftIndex:centerSplitRightIndex]
-			// rightNominativesSplit := lemmasSplit[rightSplitLeftIndex:rightSplitRightIndex]
-
-			// Join the tokens into the actual representable state for the user
-			leftText := strings.Join(leftTextSplit, " ")
-			centerText := strings.Join(centerTextSplit, " ")
-			rightText := strings.Join(rightTextSplit, " ")
-
-			// Create the object that we will be serving
-			toAppend := SearchResult{
-				LeftReverse:   utils.ReverseString(leftText),
-				Left:          leftText,
-				CenterReverse: utils.ReverseString(centerText),
-				Center:        centerText,
-				Right:         rightText,
-				Source:        v.URL,
-				Title:         v.Title,
-				Scraped:       v.CreatedAt.Format(time.RFC850),
-			}
+// sameTokens compares the matched tokens with the query tokens
+func (f *hitFinder) sameTokens(matched, tokens []string) bool {
+	for i := range tokens {
+		if f.caseSensitive && matched[i] != tokens[i] {
+			return false
+		}
+		if !f.caseSensitive && !strings.EqualFold(matched[i], tokens[i]) {
+			return false
+		}
+	}
+	return true
+}
 
-			// Append it to the final results
-			results = append(results, toAppend)
+// result creates the search result of a hit, see newSearchResult, with the
+// tokens of the boolean query match highlighted
+func (f *hitFinder) result(v storage.Text, textSplit []string, layersSplit map[string][]string, start, end int) SearchResult {
+	left, right := f.width.Bounds(textSplit, start, end)
+	if f.sentenceContext {
+		left, right = f.sentenceBounds(v, textSplit, start, end)
+	}
+	result := newSearchResult(v, textSplit, layersSplit, start, end, left, right)
+	if f.fuzzy > 0 {
+		result.Variant = f.variant(v, textSplit, start, end)
+	}
+	if f.boolean == nil {
+		return result
+	}
+	// Ordered hits come without their matches, so find them again
+	if f.boolTextID != v.ID || f.boolMatches == nil {
+		f.match(v)
+	}
+	for _, match := range f.boolMatches {
+		if match.Span != [2]int{start, end} {
+			continue
 		}
+		result.Highlights = make([]int, len(match.Positions))
+		for i, position := range match.Positions {
+			result.Highlights[i] = position - start
+		}
+		break
 	}
+	return result
+}
 
-	// Override the serving into the CSV serving function
-	if useCSV == "1" {
-		httpCSVFindResults(w, results, http.StatusOK)
-		return
+// variant returns the terms of the searched part at the [start, end) span
+func (f *hitFinder) variant(v storage.Text, textSplit []string, start, end int) string {
+	if f.partTextID != v.ID || f.partSplit == nil {
+		f.partSplit, f.partTextID = textSplit, v.ID
+		if f.part != "text" {
+			f.partSplit = strings.Split(storage.TextLayers(&v)[f.part], " ")
+		}
+	}
+	terms := make([]string, 0, end-start)
+	for i := start; i < end && i < len(f.partSplit); i++ {
+		terms = append(terms, storage.IndexTerm(f.part, f.partSplit[i]))
 	}
+	return strings.Join(terms, " ")
+}
 
-	// Fallback to the default JSON return
-	httpJSON(w, results, http.StatusOK, nil)
+// sentenceBounds returns the [left, right) token bounds of the sentences the
+// [start, end) span is in, with contextSentences more sentences on each side
+func (f *hitFinder) sentenceBounds(v storage.Text, textSplit []string, start, end int) (int, int) {
+	if f.sentenceTextID != v.ID || f.sentenceIDs == nil {
+		f.sentenceIDs, f.sentenceTextID = storage.SentenceIDs(&v, textSplit), v.ID
+	}
+	first := f.sentenceIDs[start] - f.contextSentences
+	last := f.sentenceIDs[utils.Max(start, end-1)] + f.contextSentences
+	left, right := start, end
+	for left > 0 && f.sentenceIDs[left-1] >= first {
+		left--
+	}
+	for right < len(textSplit) && f.sentenceIDs[right] <= last {
+		right++
+	}
+	return left, right
+}
+
+// newSearchResult cuts the [start, end) token span out of the text with its
+// left and right contexts, which are [left, start) and [end, right), and
+// creates the object that we will be serving, the same span is cut out of
+// every annotation layer in layersSplit
+func newSearchResult(v storage.Text, textSplit []string, layersSplit map[string][]string, start, end, left, right int) SearchResult {
+	// Find the indices that we will split the tokens from left to right
+	leftSplitLeftIndex := left
+	rightSplitRightIndex := right
+
+	// Join the tokens into the actual representable state for the user
+	leftText := strings.Join(textSplit[leftSplitLeftIndex:start], " ")
+	centerText := strings.Join(textSplit[start:end], " ")
+	rightText := strings.Join(textSplit[end:rightSplitRightIndex], " ")
+
+	result := SearchResult{
+		LeftReverse:   utils.ReverseString(leftText),
+		Left:          leftText,
+		CenterReverse: utils.ReverseString(centerText),
+		Center:        centerText,
+		Right:         rightText,
+		Source:        v.URL,
+		Title:         v.Title,
+		Scraped:       v.CreatedAt.Format(time.RFC850),
+	}
+
+	// Split the annotation tokens into the results section
+	if len(layersSplit) > 0 {
+		result.Layers = make(map[string]SearchResultLayer, len(layersSplit))
+	}
+	for layer, split := range layersSplit {
+		// Layers should be aligned with the text, but let's not trust it blindly
+		if len(split) < rightSplitRightIndex {
+			continue
+		}
+		result.Layers[layer] = SearchResultLayer{
+			Left:   split[leftSplitLeftIndex:start],
+			Center: split[start:end],
+			Right:  split[end:rightSplitRightIndex],
+		}
+	}
+	return result
 }
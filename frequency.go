@@ -2,28 +2,105 @@ package main
 
 import (
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/thecsw/katya/analysis"
+	"github.com/thecsw/katya/storage"
+	"github.com/thecsw/katya/utils"
 )
 
-// frequencyFinder returns a word frequency table for a given source
+// frequencyFinder returns a word frequency table for the given sources,
+// all the enabled sources of the user if none are given, see newScope,
+// every word comes with the number of texts it occurs in, its ipm and its
+// dispersions over the texts, min_freq, top and offset trim the table,
+// what is counted as a word is set by newFrequencyOptions
 func frequencyFinder(w http.ResponseWriter, r *http.Request) {
-	source := r.URL.Query().Get("source")
-	if source == "" {
-		httpJSON(w, nil, http.StatusBadRequest, errors.New("bad query"))
+	// grab the user context from the middleware
+	user := r.Context().Value(ContextKey("user")).(storage.User)
+	scope, err := newScope(r, user)
+	if err != nil {
+		httpJSON(w, nil, http.StatusBadRequest, err)
+		return
+	}
+	options, err := newFrequencyOptions(r)
+	if err != nil {
+		httpJSON(w, nil, http.StatusBadRequest, err)
 		return
 	}
 	// whether we should serve a CSV file instead of a JSON
 	useCSV := r.URL.Query().Get("csv")
-	result, err := analysis.FindTheMostFrequentWords(source)
+	minFreq := uint64(1)
+	if minFreqT := r.URL.Query().Get("min_freq"); minFreqT != "" {
+		minFreq, err = strconv.ParseUint(minFreqT, 10, 32)
+		if err != nil || minFreq < 1 {
+			httpJSON(w, nil, http.StatusBadRequest, errors.New("bad min_freq"))
+			return
+		}
+	}
+	// Zero means the whole table, as it always has been
+	top := 0
+	if topT := r.URL.Query().Get("top"); topT != "" {
+		top, err = strconv.Atoi(topT)
+		if err != nil || top < 1 {
+			httpJSON(w, nil, http.StatusBadRequest, errors.New("bad top"))
+			return
+		}
+	}
+	offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	// Sources only know their sizes as a whole, so dated scopes count their texts
+	numWords := uint(0)
+	if scope.From.IsZero() && scope.To.IsZero() {
+		sources, err := storage.GetScopeSources(scope)
+		if err != nil {
+			httpJSON(w, nil, http.StatusInternalServerError, errors.Wrap(err, "failed to get sources"))
+			return
+		}
+		for _, source := range sources {
+			numWords += source.NumWords
+		}
+	}
+	result, err := analysis.FindWordDistributions(scope, numWords, options)
 	if err != nil {
 		httpJSON(w, nil, http.StatusInternalServerError, errors.Wrap(err, "oops"))
 		return
 	}
+	result = analysis.FilterDistributions(result, analysis.StopwordsRU, uint(minFreq))
+	result = result[utils.Min(offset, len(result)):]
+	if top > 0 {
+		result = result[:utils.Min(top, len(result))]
+	}
 	if useCSV == "1" {
-		httpCSVFreqResults(w, result, http.StatusOK)
+		httpCSVFreqResults(w, analysis.DistributionRows(result), http.StatusOK)
 		return
 	}
-	httpJSON(w, analysis.FilterStopwordsSimple(result, analysis.StopwordsRU), http.StatusOK, nil)
+	httpJSON(w, analysis.DistributionRows(result), http.StatusOK, nil)
+}
+
+// newFrequencyOptions reads what is counted as a word: lowercased lemmas by
+// default, wordforms=1 counts the surface words instead, case_sensitive=1
+// keeps their casing, pos=NOUN,VERB only counts the words with these tags
+// and with_pos=1 tells the same word with different tags apart
+func newFrequencyOptions(r *http.Request) (analysis.FrequencyOptions, error) {
+	options := analysis.FrequencyOptions{
+		Wordforms: r.URL.Query().Get("wordforms") == "1",
+		KeepCase:  r.URL.Query().Get("case_sensitive") == "1",
+		WithPOS:   r.URL.Query().Get("with_pos") == "1",
+	}
+	if pos := r.URL.Query().Get("pos"); pos != "" {
+		options.POS = make(map[string]bool)
+		for _, tag := range strings.Split(pos, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "" || strings.ToUpper(tag) != tag {
+				return options, errors.Errorf("bad pos %q", tag)
+			}
+			options.POS[tag] = true
+		}
+	}
+	return options, nil
 }
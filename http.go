@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/thecsw/katya/analysis"
 )
@@ -12,6 +14,8 @@ import (
 const (
 	csvHeaderForFind        = "normal"
 	csvHeaderForFrequencies = "freq"
+	csvHeaderForNGrams      = "ngrams"
+	csvHeaderForKeywords    = "keywords"
 )
 
 var (
@@ -24,7 +28,16 @@ var (
 		},
 
 		csvHeaderForFrequencies: {
-			"lemma", "hits",
+			"word", "hits", "texts", "ipm", "juilland d", "gries dp",
+		},
+
+		csvHeaderForNGrams: {
+			"ngram", "hits",
+		},
+
+		csvHeaderForKeywords: {
+			"word", "focus", "reference", "focus ipm", "reference ipm",
+			"log likelihood", "p value", "percent diff", "simple maths", "log ratio",
 		},
 	}
 )
@@ -39,29 +52,112 @@ type httpErrorReturn struct {
 	Error string `json:"error"`
 }
 
+// csvFindColumns tells which optional columns the find CSV files have
+type csvFindColumns struct {
+	// layers are the annotation layers, see csvFindHeader
+	layers []string
+	// variant adds the matched variant of fuzzy searches
+	variant bool
+	// highlights adds the highlighted center tokens of boolean queries
+	highlights bool
+}
+
 // httpCSVFindResults sends the results of SearchResult in a CSV formatted string
-func httpCSVFindResults(w http.ResponseWriter, results []SearchResult, status int) {
+func httpCSVFindResults(w http.ResponseWriter, results []SearchResult, columns csvFindColumns, status int) {
 	w.Header().Set("Content-Type", "application/csv")
 	w.Header().Set("X-Content-Type-Options", "nosniff")
 	w.WriteHeader(status)
 	toWrite := make([][]string, 0, len(results)+1)
-	toWrite = append(toWrite, csvHeaders[csvHeaderForFind])
+	toWrite = append(toWrite, csvFindHeader(columns))
 	for _, v := range results {
-		toWrite = append(toWrite, []string{
-			v.LeftReverse, v.CenterReverse, v.Left, v.Center, v.Right, v.Source, v.Title, v.Scraped,
-		})
+		toWrite = append(toWrite, csvFindRow(v, columns))
+	}
+	_ = csv.NewWriter(w).WriteAll(toWrite)
+}
+
+// csvFindHeader returns the find header with left, center and right
+// columns appended for every requested annotation layer, then the
+// variant and highlights columns if they're asked for
+func csvFindHeader(columns csvFindColumns) []string {
+	header := append([]string{}, csvHeaders[csvHeaderForFind]...)
+	for _, layer := range columns.layers {
+		header = append(header, "left "+layer, "center "+layer, "right "+layer)
+	}
+	if columns.variant {
+		header = append(header, "variant")
+	}
+	if columns.highlights {
+		header = append(header, "highlights")
+	}
+	return header
+}
+
+// csvFindRow turns a SearchResult into a CSV row that follows the find header,
+// annotations are joined with spaces, just like the text itself
+func csvFindRow(v SearchResult, columns csvFindColumns) []string {
+	row := []string{
+		v.LeftReverse, v.CenterReverse, v.Left, v.Center, v.Right, v.Source, v.Title, v.Scraped,
+	}
+	for _, layer := range columns.layers {
+		annotation := v.Layers[layer]
+		row = append(row,
+			strings.Join(annotation.Left, " "),
+			strings.Join(annotation.Center, " "),
+			strings.Join(annotation.Right, " "),
+		)
 	}
+	if columns.variant {
+		row = append(row, v.Variant)
+	}
+	if columns.highlights {
+		highlights := make([]string, len(v.Highlights))
+		for i, highlight := range v.Highlights {
+			highlights[i] = strconv.Itoa(highlight)
+		}
+		row = append(row, strings.Join(highlights, " "))
+	}
+	return row
+}
+
+// httpCSVFreqResults sends the frequency rows of analysis.DistributionRows as a CSV
+func httpCSVFreqResults(w http.ResponseWriter, results [][]string, status int) {
+	w.Header().Set("Content-Type", "application/csv")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	toWrite := append([][]string{csvHeaders[csvHeaderForFrequencies]}, results...)
+	_ = csv.NewWriter(w).WriteAll(toWrite)
+}
+
+// httpCSVNGramResults sends the n-gram rows of analysis.TopNGrams as a CSV
+func httpCSVNGramResults(w http.ResponseWriter, results [][]string, status int) {
+	w.Header().Set("Content-Type", "application/csv")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	toWrite := append([][]string{csvHeaders[csvHeaderForNGrams]}, results...)
 	_ = csv.NewWriter(w).WriteAll(toWrite)
 }
 
-func httpCSVFreqResults(w http.ResponseWriter, results map[string]uint, status int) {
+// httpCSVKeywordResults sends the keywords as a CSV
+func httpCSVKeywordResults(w http.ResponseWriter, results []analysis.Keyword, status int) {
 	w.Header().Set("Content-Type", "application/csv")
 	w.Header().Set("X-Content-Type-Options", "nosniff")
 	w.WriteHeader(status)
-	toWrite := append(
-		[][]string{csvHeaders[csvHeaderForFrequencies]},
-		analysis.FilterStopwordsSimple(results, analysis.StopwordsRU)...,
-	)
+	toWrite := make([][]string, 0, len(results)+1)
+	toWrite = append(toWrite, csvHeaders[csvHeaderForKeywords])
+	for _, v := range results {
+		toWrite = append(toWrite, []string{
+			v.Word,
+			strconv.FormatUint(uint64(v.Focus), 10),
+			strconv.FormatUint(uint64(v.Reference), 10),
+			strconv.FormatFloat(v.FocusIPM, 'f', -1, 64),
+			strconv.FormatFloat(v.ReferenceIPM, 'f', -1, 64),
+			strconv.FormatFloat(v.LogLikelihood, 'f', -1, 64),
+			strconv.FormatFloat(v.PValue, 'g', -1, 64),
+			strconv.FormatFloat(v.PercentDiff, 'f', -1, 64),
+			strconv.FormatFloat(v.SimpleMaths, 'f', -1, 64),
+			strconv.FormatFloat(v.LogRatio, 'f', -1, 64),
+		})
+	}
 	_ = csv.NewWriter(w).WriteAll(toWrite)
 }
 
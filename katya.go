@@ -119,6 +119,25 @@ func main() {
 		}
 	}()
 
+	// Running `katya reindex` rebuilds the inverted index and the vocabulary of all texts and quits
+	if len(os.Args) > 1 && os.Args[1] == "reindex" {
+		log.Info("Rebuilding the inverted index")
+		indexed, err := storage.RebuildIndex()
+		if err != nil {
+			log.Error("Failed rebuilding the inverted index", err, log.Params{"indexed": indexed})
+			return
+		}
+		log.Format("Rebuilt the inverted index", log.Params{"indexed": indexed})
+		log.Info("Recounting the vocabulary")
+		counted, err := storage.RebuildVocabulary()
+		if err != nil {
+			log.Error("Failed recounting the vocabulary", err, log.Params{"counted": counted})
+			return
+		}
+		log.Format("Recounted the vocabulary", log.Params{"counted": counted})
+		return
+	}
+
 	// +-------------------------------------+
 	// |             OTHER STUFF             |
 	// +-------------------------------------+
@@ -173,8 +192,19 @@ func main() {
 	subRouter.HandleFunc("/allocate", crawlerCreator).Methods(http.MethodPost)
 	subRouter.HandleFunc("/source", userCreateSource).Methods(http.MethodPost)
 	subRouter.HandleFunc("/source", userDeleteSource).Methods(http.MethodDelete)
+	subRouter.HandleFunc("/subcorpora", userGetSubcorpora).Methods(http.MethodGet)
+	subRouter.HandleFunc("/subcorpus", userCreateSubcorpus).Methods(http.MethodPost)
+	subRouter.HandleFunc("/subcorpus", userDeleteSubcorpus).Methods(http.MethodDelete)
 	subRouter.HandleFunc("/frequencies", frequencyFinder).Methods(http.MethodGet)
 	subRouter.HandleFunc("/relations", findRelations).Methods(http.MethodGet)
+	subRouter.HandleFunc("/collocates", findCollocates).Methods(http.MethodGet)
+	subRouter.HandleFunc("/ngrams", ngramsFinder).Methods(http.MethodGet)
+	subRouter.HandleFunc("/keywords", keywordsFinder).Methods(http.MethodGet)
+	subRouter.HandleFunc("/stats/lexical", lexicalStats).Methods(http.MethodGet)
+	subRouter.HandleFunc("/paradigm", paradigmFinder).Methods(http.MethodGet)
+	subRouter.HandleFunc("/autocomplete", autocomplete).Methods(http.MethodGet)
+	subRouter.HandleFunc("/didyoumean", didYouMean).Methods(http.MethodGet)
+	subRouter.HandleFunc("/documents", documentsFinder).Methods(http.MethodGet)
 	subRouter.HandleFunc("/clean", cleanTexts).Methods(http.MethodGet)
 	subRouter.HandleFunc("/status", crawlerStatusReceiver).Methods(http.MethodGet)
 
@@ -205,7 +235,7 @@ func main() {
 		AllowedOrigins:     allowedOrigins,
 		AllowedMethods:     allowedMethods,
 		AllowedHeaders:     allowedHeaders,
-		ExposedHeaders:     []string{},
+		ExposedHeaders:     []string{didYouMeanHeader},
 		MaxAge:             0,
 		AllowCredentials:   true,
 		OptionsPassthrough: false,
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/thecsw/katya/analysis"
+	"github.com/thecsw/katya/storage"
+)
+
+const (
+	// defaultKeywordsMinFreq drops the keywords that are too rare to tell
+	defaultKeywordsMinFreq = 3
+	// defaultKeywordsMaxP only keeps the significant keywords by default
+	defaultKeywordsMaxP = 0.05
+	// defaultKeywordsSmoothing is the constant of the simple maths ratio
+	defaultKeywordsSmoothing = 1
+	// defaultKeywordsTop is how many keywords we return by default
+	defaultKeywordsTop = 100
+)
+
+// keywordsFinder compares the words (see newFrequencyOptions) of the focus
+// sources (see newScope) with the reference ones (the same parameters prefixed
+// with reference_), at least one of them has to be given and the other one
+// is all the other enabled sources, and returns the keywords of the focus,
+// or the words it lacks with negative=1
+func keywordsFinder(w http.ResponseWriter, r *http.Request) {
+	// grab the user context from the middleware
+	user := r.Context().Value(ContextKey("user")).(storage.User)
+	focus, err := newScope(r, user)
+	if err != nil {
+		httpJSON(w, nil, http.StatusBadRequest, err)
+		return
+	}
+	reference, err := newPrefixedScope(r, user, "reference_")
+	if err != nil {
+		httpJSON(w, nil, http.StatusBadRequest, err)
+		return
+	}
+	// Without any sources both would be the same enabled sources, otherwise
+	// the missing side is the rest of the enabled sources
+	switch {
+	case len(focus.Sources) == 0 && len(reference.Sources) == 0:
+		httpJSON(w, nil, http.StatusBadRequest, errors.New("either focus or reference sources have to be given"))
+		return
+	case len(reference.Sources) == 0:
+		reference.Exclude = append(reference.Exclude, focus.Sources...)
+	case len(focus.Sources) == 0:
+		focus.Exclude = append(focus.Exclude, reference.Sources...)
+	}
+
+	measure := r.URL.Query().Get("measure")
+	if measure == "" {
+		measure = "log_likelihood"
+	}
+	if _, ok := analysis.KeynessMeasures[measure]; !ok {
+		httpJSON(w, nil, http.StatusBadRequest, errors.New("bad measure"))
+		return
+	}
+	minFreq := uint64(defaultKeywordsMinFreq)
+	if minFreqT := r.URL.Query().Get("min_freq"); minFreqT != "" {
+		minFreq, err = strconv.ParseUint(minFreqT, 10, 32)
+		if err != nil || minFreq < 1 {
+			httpJSON(w, nil, http.StatusBadRequest, errors.New("bad min_freq"))
+			return
+		}
+	}
+	maxP := defaultKeywordsMaxP
+	if maxPT := r.URL.Query().Get("max_p"); maxPT != "" {
+		maxP, err = strconv.ParseFloat(maxPT, 64)
+		if err != nil || maxP <= 0 || maxP > 1 {
+			httpJSON(w, nil, http.StatusBadRequest, errors.New("bad max_p"))
+			return
+		}
+	}
+	smoothing := float64(defaultKeywordsSmoothing)
+	if smoothingT := r.URL.Query().Get("smoothing"); smoothingT != "" {
+		smoothing, err = strconv.ParseFloat(smoothingT, 64)
+		if err != nil || smoothing <= 0 {
+			httpJSON(w, nil, http.StatusBadRequest, errors.New("bad smoothing"))
+			return
+		}
+	}
+	top := defaultKeywordsTop
+	if topT := r.URL.Query().Get("top"); topT != "" {
+		top, err = strconv.Atoi(topT)
+		if err != nil || top < 1 {
+			httpJSON(w, nil, http.StatusBadRequest, errors.New("bad top"))
+			return
+		}
+	}
+	negative := r.URL.Query().Get("negative") == "1"
+	options, err := newFrequencyOptions(r)
+	if err != nil {
+		httpJSON(w, nil, http.StatusBadRequest, err)
+		return
+	}
+	// whether we should serve a CSV file instead of a JSON
+	useCSV := r.URL.Query().Get("csv")
+
+	keywords, err := analysis.FindKeywords(focus, reference, smoothing, options)
+	if err != nil {
+		httpJSON(w, nil, http.StatusInternalServerError, errors.Wrap(err, "failed to find keywords"))
+		return
+	}
+	keywords = analysis.FilterKeywords(keywords, analysis.StopwordsRU, uint(minFreq), maxP, negative)
+	analysis.SortKeywords(keywords, measure, negative)
+	if len(keywords) > top {
+		keywords = keywords[:top]
+	}
+	if useCSV == "1" {
+		httpCSVKeywordResults(w, keywords, http.StatusOK)
+		return
+	}
+	httpJSON(w, keywords, http.StatusOK, nil)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/thecsw/katya/analysis"
+	"github.com/thecsw/katya/storage"
+)
+
+// lexicalStats returns the lexical statistics of the given sources or
+// subcorpus (see newScope), growth_step= is the number of tokens between
+// the points of the vocabulary growth curve
+func lexicalStats(w http.ResponseWriter, r *http.Request) {
+	// grab the user context from the middleware
+	user := r.Context().Value(ContextKey("user")).(storage.User)
+	scope, err := newScope(r, user)
+	if err != nil {
+		httpJSON(w, nil, http.StatusBadRequest, err)
+		return
+	}
+	growthStep := uint64(analysis.STTRChunk)
+	if growthStepT := r.URL.Query().Get("growth_step"); growthStepT != "" {
+		growthStep, err = strconv.ParseUint(growthStepT, 10, 32)
+		if err != nil || growthStep < 1 {
+			httpJSON(w, nil, http.StatusBadRequest, errors.New("bad growth_step"))
+			return
+		}
+	}
+	result, err := analysis.FindLexicalStats(scope, uint(growthStep))
+	if err != nil {
+		httpJSON(w, nil, http.StatusInternalServerError, errors.Wrap(err, "failed to compute lexical stats"))
+		return
+	}
+	httpJSON(w, result, http.StatusOK, nil)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/thecsw/katya/analysis"
+	"github.com/thecsw/katya/storage"
+)
+
+const (
+	// defaultNGramsMinFreq drops the n-grams that were seen only once
+	defaultNGramsMinFreq = 2
+	// defaultNGramsTop is how many n-grams we return by default
+	defaultNGramsTop = 100
+)
+
+// ngramsFinder returns the most frequent n-grams of a layer in the given
+// sources (see newScope), like "ADJ NOUN ADP NOUN" on tags. Punctuation
+// breaks n-grams unless punct=1 is given and stopwords=1 drops the
+// n-grams that start or end with a stopword
+func ngramsFinder(w http.ResponseWriter, r *http.Request) {
+	// grab the user context from the middleware
+	user := r.Context().Value(ContextKey("user")).(storage.User)
+	scope, err := newScope(r, user)
+	if err != nil {
+		httpJSON(w, nil, http.StatusBadRequest, err)
+		return
+	}
+
+	layer := r.URL.Query().Get("layer")
+	if layer == "" {
+		layer = "lemmas"
+	}
+	if _, ok := storage.MapPartToFindFunction[layer]; !ok {
+		httpJSON(w, nil, http.StatusBadRequest, errors.New("bad layer"))
+		return
+	}
+	n := analysis.MinNGram
+	if nT := r.URL.Query().Get("n"); nT != "" {
+		n, err = strconv.Atoi(nT)
+		if err != nil || n < analysis.MinNGram || n > analysis.MaxNGram {
+			httpJSON(w, nil, http.StatusBadRequest,
+				errors.Errorf("n has to be between %d and %d", analysis.MinNGram, analysis.MaxNGram))
+			return
+		}
+	}
+	minFreq := uint64(defaultNGramsMinFreq)
+	if minFreqT := r.URL.Query().Get("min_freq"); minFreqT != "" {
+		minFreq, err = strconv.ParseUint(minFreqT, 10, 32)
+		if err != nil || minFreq < 1 {
+			httpJSON(w, nil, http.StatusBadRequest, errors.New("bad min_freq"))
+			return
+		}
+	}
+	top := defaultNGramsTop
+	if topT := r.URL.Query().Get("top"); topT != "" {
+		top, err = strconv.Atoi(topT)
+		if err != nil || top < 1 {
+			httpJSON(w, nil, http.StatusBadRequest, errors.New("bad top"))
+			return
+		}
+	}
+	filter := analysis.NGramFilter{
+		Punctuation: r.URL.Query().Get("punct") != "1",
+		Stopwords:   r.URL.Query().Get("stopwords") == "1",
+	}
+	// whether we should serve a CSV file instead of a JSON
+	useCSV := r.URL.Query().Get("csv")
+
+	counts, err := analysis.FindNGrams(scope, layer, n, filter, analysis.StopwordsRU)
+	if err != nil {
+		httpJSON(w, nil, http.StatusInternalServerError, errors.Wrap(err, "failed to count n-grams"))
+		return
+	}
+	result := analysis.TopNGrams(counts, uint(minFreq), top)
+	if useCSV == "1" {
+		httpCSVNGramResults(w, result, http.StatusOK)
+		return
+	}
+	httpJSON(w, result, http.StatusOK, nil)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/thecsw/katya/analysis"
+	"github.com/thecsw/katya/storage"
+)
+
+// paradigmFinder returns every surface form the lemma was realised as in
+// the given sources (see newScope) with their counts, tags and an example
+func paradigmFinder(w http.ResponseWriter, r *http.Request) {
+	// grab the user context from the middleware
+	user := r.Context().Value(ContextKey("user")).(storage.User)
+	scope, err := newScope(r, user)
+	if err != nil {
+		httpJSON(w, nil, http.StatusBadRequest, err)
+		return
+	}
+	lemma := r.URL.Query().Get("lemma")
+	if lemma == "" {
+		httpJSON(w, nil, http.StatusBadRequest, errors.New("bad lemma"))
+		return
+	}
+	result, err := analysis.FindParadigm(scope, lemma)
+	if err != nil {
+		httpJSON(w, nil, http.StatusInternalServerError, errors.Wrap(err, "failed to find paradigm"))
+		return
+	}
+	httpJSON(w, result, http.StatusOK, nil)
+}
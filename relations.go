@@ -9,10 +9,26 @@ import (
 	"github.com/thecsw/katya/storage"
 )
 
+const (
+	// relationsBatchSize is how many texts we load at a time for relations
+	relationsBatchSize = 100
+	// maxRelationsWidth is the widest window around the target one can ask for
+	maxRelationsWidth = 50
+)
+
+// findRelations returns the words that occur within width= tokens (up to
+// maxRelationsWidth) around the target in the given sources, all the
+// enabled sources of the user if none are given,
+// measure= sorts them by an association measure (see AssociationMeasures),
+// min_freq= drops the ones that co-occurred too few times and
+// same_sentence=1 doesn't let the window cross the target's sentence, the
+// evidences are as wide as newContextWidth says
 func findRelations(w http.ResponseWriter, r *http.Request) {
-	source := r.URL.Query().Get("source")
-	if source == "" {
-		httpJSON(w, nil, http.StatusBadRequest, errors.New("bad query"))
+	// grab the user context from the middleware
+	user := r.Context().Value(ContextKey("user")).(storage.User)
+	scope, err := newScope(r, user)
+	if err != nil {
+		httpJSON(w, nil, http.StatusBadRequest, err)
 		return
 	}
 	target := r.URL.Query().Get("target")
@@ -20,25 +36,55 @@ func findRelations(w http.ResponseWriter, r *http.Request) {
 		httpJSON(w, nil, http.StatusBadRequest, errors.New("bad target"))
 		return
 	}
-	widthT := r.URL.Query().Get("width")
-	if widthT == "" {
-		httpJSON(w, nil, http.StatusBadRequest, errors.New("bad width"))
+	width, err := strconv.Atoi(r.URL.Query().Get("width"))
+	if err != nil || width < 1 || width > maxRelationsWidth {
+		httpJSON(w, nil, http.StatusBadRequest, errors.Errorf("width must be within 1..%d", maxRelationsWidth))
+		return
+	}
+	// Raw co-occurrence counts are the default, as they always have been
+	measure := r.URL.Query().Get("measure")
+	if measure == "" {
+		measure = "freq"
+	}
+	if _, ok := analysis.AssociationMeasures[measure]; !ok {
+		httpJSON(w, nil, http.StatusBadRequest, errors.New("bad measure"))
 		return
 	}
-	width, _ := strconv.Atoi(widthT)
-	sourceObj, err := storage.GetSource(source, true)
+	minFreq := 1
+	if minFreqT := r.URL.Query().Get("min_freq"); minFreqT != "" {
+		minFreq, err = strconv.Atoi(minFreqT)
+		if err != nil || minFreq < 1 {
+			httpJSON(w, nil, http.StatusBadRequest, errors.New("bad min_freq"))
+			return
+		}
+	}
+	sameSentence := r.URL.Query().Get("same_sentence") == "1"
+	context, err := newContextWidth(r, analysis.DefaultEvidenceWidth)
 	if err != nil {
-		httpJSON(w, nil, http.StatusInternalServerError, errors.Wrap(err, "oops"))
+		httpJSON(w, nil, http.StatusBadRequest, err)
 		return
 	}
-	texts, err := storage.GetSourcesTexts(sourceObj.ID)
+	// Count a batch of texts at a time, so we never hold all of them
+	relations := make(map[string]*analysis.Relation)
+	counts, numTokens := make(map[string]uint), uint(0)
+	err = storage.WalkScopedTexts(scope, relationsBatchSize, func(texts []storage.Text) error {
+		analysis.MergeRelations(relations, analysis.FindRelations(texts, target, width, sameSentence, context))
+		batchCounts, batchTokens := analysis.CountLemmas(texts)
+		for lemma, count := range batchCounts {
+			counts[lemma] += count
+		}
+		numTokens += batchTokens
+		return nil
+	})
 	if err != nil {
 		httpJSON(w, nil, http.StatusInternalServerError, errors.Wrap(err, "oops"))
 		return
 	}
-	relations := analysis.FindRelations(texts, target, width)
+	analysis.ScoreRelations(relations, target, counts, numTokens, 2*width)
 
 	sorted := analysis.FilterStopwords(relations, analysis.StopwordsRU)
+	sorted = analysis.FilterMinFrequency(sorted, minFreq)
+	analysis.SortByMeasure(sorted, measure)
 
 	httpJSON(w, sorted, http.StatusOK, nil)
 }
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"math/rand"
+)
+
+const (
+	// maxSampleSize is the largest sample of hits one can ask for
+	maxSampleSize = 100000
+)
+
+// hitSampler draws a uniform random sample of hits in a single pass with
+// reservoir sampling, so we never have to keep all the hits in memory
+type hitSampler struct {
+	// size is the number of hits we want to draw
+	size int
+	// seen is the number of hits we have been offered so far
+	seen int
+	// random is the seeded source of randomness of this sample
+	random *rand.Rand
+	// reservoir is the current sample
+	reservoir []hitRef
+}
+
+// newHitSampler creates a sampler, returns nil if no sample is requested
+func newHitSampler(size int, seed int64) *hitSampler {
+	if size < 1 {
+		return nil
+	}
+	return &hitSampler{
+		size:      size,
+		random:    rand.New(rand.NewSource(seed)),
+		reservoir: make([]hitRef, 0, size),
+	}
+}
+
+// add offers the next hit to the sample, every hit seen so far has the
+// same size/seen chance of being in the sample
+func (s *hitSampler) add(ref hitRef) {
+	s.seen++
+	if len(s.reservoir) < s.size {
+		s.reservoir = append(s.reservoir, ref)
+		return
+	}
+	if j := s.random.Intn(s.seen); j < s.size {
+		s.reservoir[j] = ref
+	}
+}
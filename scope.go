@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/thecsw/katya/storage"
+)
+
+const (
+	// scopeDateFormat is the short date format of from and to
+	scopeDateFormat = "2006-01-02"
+)
+
+// newScope reads the source scoping parameters shared by /find, /frequencies
+// and /relations. sources (or source) and exclude take comma-separated links
+// or IDs of the user's sources, subcorpus adds the sources of a subcorpus,
+// from and to take dates (2006-01-02) or timestamps (RFC3339), where a date
+// in to includes the whole day
+func newScope(r *http.Request, user storage.User) (storage.Scope, error) {
+	return newPrefixedScope(r, user, "")
+}
+
+// newPrefixedScope is newScope with every parameter name prefixed, so a
+// request can carry more than one scope, like reference_sources=
+func newPrefixedScope(r *http.Request, user storage.User, prefix string) (storage.Scope, error) {
+	scope := storage.Scope{UserID: user.ID}
+	sources := append(r.URL.Query()[prefix+"sources"], r.URL.Query()[prefix+"source"]...)
+	exclude := r.URL.Query()[prefix+"exclude"]
+	if len(sources) > 0 || len(exclude) > 0 {
+		owned, err := storage.GetUserSources(user.Name)
+		if err != nil {
+			return scope, errors.Wrap(err, "failed to get user's sources")
+		}
+		if scope.Sources, err = resolveSources(sources, owned); err != nil {
+			return scope, err
+		}
+		if scope.Exclude, err = resolveSources(exclude, owned); err != nil {
+			return scope, err
+		}
+	}
+	if name := r.URL.Query().Get(prefix + "subcorpus"); name != "" {
+		subcorpus, err := storage.GetSubcorpus(user.ID, name)
+		if err != nil {
+			return scope, errors.Errorf("unknown subcorpus %q", name)
+		}
+		// An empty list of sources would mean all the enabled ones
+		if len(subcorpus.Sources) == 0 {
+			return scope, errors.Errorf("subcorpus %q has no sources", name)
+		}
+		for _, source := range subcorpus.Sources {
+			scope.Sources = append(scope.Sources, source.ID)
+		}
+	}
+	var err error
+	if from := r.URL.Query().Get(prefix + "from"); from != "" {
+		if scope.From, err = parseScopeDate(from, false); err != nil {
+			return scope, errors.Errorf("bad %sfrom date", prefix)
+		}
+	}
+	if to := r.URL.Query().Get(prefix + "to"); to != "" {
+		if scope.To, err = parseScopeDate(to, true); err != nil {
+			return scope, errors.Errorf("bad %sto date", prefix)
+		}
+	}
+	if !scope.From.IsZero() && !scope.To.IsZero() && !scope.From.Before(scope.To) {
+		return scope, errors.Errorf("%sfrom has to be before %sto", prefix, prefix)
+	}
+	return scope, nil
+}
+
+// resolveSources maps links or IDs to the IDs of the user's sources
+func resolveSources(values []string, owned []storage.Source) ([]uint, error) {
+	ids := make([]uint, 0, len(values))
+	for _, value := range values {
+		for _, source := range strings.Split(value, ",") {
+			source = strings.TrimSpace(source)
+			if source == "" {
+				continue
+			}
+			id, found := uint(0), false
+			for _, v := range owned {
+				if v.Link == source || strconv.FormatUint(uint64(v.ID), 10) == source {
+					id, found = v.ID, true
+					break
+				}
+			}
+			if !found {
+				return nil, errors.Errorf("unknown source %q", source)
+			}
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// parseScopeDate parses a date or a timestamp, a date that ends
+// the range is moved to the start of the next day
+func parseScopeDate(value string, end bool) (time.Time, error) {
+	if date, err := time.Parse(scopeDateFormat, value); err == nil {
+		if end {
+			date = date.AddDate(0, 0, 1)
+		}
+		return date, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
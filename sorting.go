@@ -0,0 +1,155 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/thecsw/katya/storage"
+	"github.com/thecsw/katya/utils"
+)
+
+const (
+	// sortBatchSize is how many texts we walk through at a time for sorting
+	sortBatchSize = 200
+	// maxSortedHits is the most hits we hold in memory to sort them, the
+	// same as the largest sample, which can be sorted instead
+	maxSortedHits = maxSampleSize
+	// sortDateLayout is a fixed width RFC3339 layout, so dates compare as
+	// strings, RFC3339Nano drops trailing zeros of the fractional seconds
+	sortDateLayout = "2006-01-02T15:04:05.000000000Z07:00"
+)
+
+var (
+	// errTooManyHits is returned when a query has too many hits to sort
+	errTooManyHits = errors.Errorf("can't sort more than %d hits, narrow the query down or sample it", maxSortedHits)
+
+	// sortKeys maps the sort options to the functions that create the key
+	// of a hit, from the text tokens and the [start, end) span of the hit
+	sortKeys = map[string]func(v storage.Text, textSplit []string, start, end int) string{
+		"left1":  func(_ storage.Text, t []string, start, _ int) string { return tokenAt(t, start-1) },
+		"left2":  func(_ storage.Text, t []string, start, _ int) string { return tokenAt(t, start-2) },
+		"right1": func(_ storage.Text, t []string, _, end int) string { return tokenAt(t, end) },
+		"right2": func(_ storage.Text, t []string, _, end int) string { return tokenAt(t, end+1) },
+		"center": func(_ storage.Text, t []string, start, end int) string {
+			return strings.ToLower(strings.Join(t[start:end], " "))
+		},
+		"source": func(v storage.Text, _ []string, _, _ int) string { return v.URL },
+		"date":   func(v storage.Text, _ []string, _, _ int) string { return v.CreatedAt.UTC().Format(sortDateLayout) },
+	}
+)
+
+// hitRef points to a single hit of a text with the key it's sorted by
+type hitRef struct {
+	textID uint
+	start  int
+	end    int
+	key    string
+}
+
+// tokenAt returns the lowercased token at i or an empty string if it's out of bounds
+func tokenAt(tokens []string, i int) string {
+	if i < 0 || i >= len(tokens) {
+		return ""
+	}
+	return strings.ToLower(tokens[i])
+}
+
+// orderedHits walks through every hit of the query, draws a sample of them if
+// asked to, and sorts them by the sort key, ties (or everything if no sort key
+// is given) are broken by the text and the position of the hit to keep pages stable
+func (f *hitFinder) orderedHits() ([]hitRef, error) {
+	keyOf := sortKeys[f.sortBy]
+	sampler := newHitSampler(f.sample, f.seed)
+	refs := make([]hitRef, 0, 1024)
+	err := f.walk(sortBatchSize, func(hits []textHits) error {
+		for _, v := range hits {
+			textSplit := strings.Split(v.text.Text, " ")
+			for _, span := range v.spans {
+				ref := hitRef{textID: v.text.ID, start: span[0], end: span[1]}
+				if keyOf != nil {
+					ref.key = keyOf(v.text, textSplit, span[0], span[1])
+				}
+				if sampler != nil {
+					sampler.add(ref)
+					continue
+				}
+				if len(refs) == maxSortedHits {
+					return errTooManyHits
+				}
+				refs = append(refs, ref)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if sampler != nil {
+		refs = sampler.reservoir
+	}
+	sort.SliceStable(refs, func(i, j int) bool {
+		if refs[i].key != refs[j].key {
+			return refs[i].key < refs[j].key
+		}
+		if refs[i].textID != refs[j].textID {
+			return refs[i].textID < refs[j].textID
+		}
+		return refs[i].start < refs[j].start
+	})
+	return refs, nil
+}
+
+// ordered tells whether the hits have to be collected before serving them
+func (f *hitFinder) ordered() bool {
+	return f.sortBy != "" || f.sample > 0
+}
+
+// resultsOf loads the texts of the hits and creates their results in the same order
+func (f *hitFinder) resultsOf(refs []hitRef) ([]SearchResult, error) {
+	textIDs := make([]uint, 0, len(refs))
+	seen := make(map[uint]bool, len(refs))
+	for _, ref := range refs {
+		if !seen[ref.textID] {
+			textIDs = append(textIDs, ref.textID)
+			seen[ref.textID] = true
+		}
+	}
+	texts, err := storage.GetTextsByIDs(textIDs)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]storage.Text, len(texts))
+	for _, v := range texts {
+		byID[v.ID] = v
+	}
+	results := make([]SearchResult, 0, len(refs))
+	textSplits := make(map[uint][]string, len(texts))
+	layersSplits := make(map[uint]map[string][]string, len(texts))
+	for _, ref := range refs {
+		v, ok := byID[ref.textID]
+		if !ok {
+			continue
+		}
+		if _, ok := textSplits[v.ID]; !ok {
+			textSplits[v.ID] = strings.Split(v.Text, " ")
+			layersSplits[v.ID] = f.splitLayers(v)
+		}
+		results = append(results, f.result(v, textSplits[v.ID], layersSplits[v.ID], ref.start, ref.end))
+	}
+	return results, nil
+}
+
+// walkOrdered goes through the results of the ordered hits in batches
+func (f *hitFinder) walkOrdered(refs []hitRef, batchSize int, fn func(results []SearchResult) error) error {
+	for offset := 0; offset < len(refs); offset += batchSize {
+		results, err := f.resultsOf(refs[offset:utils.Min(len(refs), offset+batchSize)])
+		if err != nil {
+			return err
+		}
+		if err := fn(results); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package storage
+
+import "github.com/pkg/errors"
+
+// DocumentPosting is where a term occurs in a text along with the text's
+// length, which is all that ranking the text by the term needs
+type DocumentPosting struct {
+	// TextID is the text where the term occurs
+	TextID uint
+	// Term is the indexed term, see IndexTerm
+	Term string
+	// Positions are the token offsets of the term in the text
+	Positions []int
+	// Length is the number of words of the text
+	Length uint
+}
+
+// documentPostingRow is a posting joined with the length of its text
+type documentPostingRow struct {
+	TextID    uint
+	Term      string
+	Positions string
+	NumWords  uint
+}
+
+// FindDocumentPostingsInScope returns the postings of the terms of a layer
+// in the scope's texts, every text and term pair comes up only once
+func FindDocumentPostingsInScope(layer string, scope Scope, terms []string) ([]DocumentPosting, error) {
+	if len(terms) == 0 {
+		return nil, errors.New("no terms given")
+	}
+	rows := make([]documentPostingRow, 0, 256)
+	err := joinScopedTexts(DB.Table("postings"), "postings.text_id", scope).
+		Joins("INNER JOIN texts document_texts on document_texts.id = postings.text_id").
+		Select("DISTINCT postings.text_id, postings.term, postings.positions, document_texts.num_words").
+		Where("postings.layer = ? AND postings.term IN ?", layer, terms).
+		Scan(&rows).
+		Error
+	if err != nil {
+		return nil, err
+	}
+	postings := make([]DocumentPosting, len(rows))
+	for i, v := range rows {
+		postings[i] = DocumentPosting{
+			TextID:    v.TextID,
+			Term:      v.Term,
+			Positions: parsePositions(v.Positions),
+			Length:    v.NumWords,
+		}
+	}
+	return postings, nil
+}
+
+// CountScopedTexts returns the number of the scope's texts and the number
+// of their words, a text linked to multiple sources of the scope counts once
+func CountScopedTexts(scope Scope) (numTexts uint, numWords uint, err error) {
+	textIDs := joinScopedTexts(DB.Table("texts"), "texts.id", scope).Select("texts.id")
+	counts := struct {
+		NumTexts uint
+		NumWords uint
+	}{}
+	err = DB.Model(&Text{}).
+		Select("COUNT(*) AS num_texts, COALESCE(SUM(num_words), 0) AS num_words").
+		Where("id IN (?)", textIDs).
+		Scan(&counts).
+		Error
+	return counts.NumTexts, counts.NumWords, err
+}
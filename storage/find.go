@@ -1,61 +1,131 @@
 package storage
 
-import "strings"
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
 
 var (
 	// MapPartToFindFunction maps a text type to the find function of its type
-	MapPartToFindFunction = map[string]func(uint, string, int, int, bool) ([]Text, error){
-		"text":   FindTextsByUserID,
-		"shapes": FindShapesByUserID,
-		"tags":   FindTagsByUserID,
-		"lemmas": FindLemmasByUserID,
+	MapPartToFindFunction = map[string]func(Scope, string, int, int, bool) ([]Text, error){
+		"text":   FindTextsInScope,
+		"shapes": FindShapesInScope,
+		"tags":   FindTagsInScope,
+		"lemmas": FindLemmasInScope,
+	}
+
+	// MapNormalizedPartToFindFunction maps a text type to the find function of its
+	// normalized shadow, only the types that have a shadow are in here
+	MapNormalizedPartToFindFunction = map[string]func(Scope, string, int, int, bool) ([]Text, error){
+		"text":   FindNormalizedTextsInScope,
+		"lemmas": FindNormalizedLemmasInScope,
 	}
 )
 
-// FindTextsByUserID runs a DB search against the text part of texts
-func FindTextsByUserID(userID uint,
+// FindTextsInScope runs a DB search against the text part of texts
+func FindTextsInScope(scope Scope,
+	query string,
+	limit int,
+	offset int,
+	caseSensitive bool,
+) ([]Text, error) {
+	return findTextsPartsInScope("texts.text", scope, query, limit, offset, caseSensitive)
+}
+
+// FindShapesInScope runs a DB search against the shapes part of texts
+func FindShapesInScope(scope Scope,
+	query string,
+	limit int,
+	offset int,
+	caseSensitive bool,
+) ([]Text, error) {
+	return findTextsPartsInScope("texts.shapes", scope, query, limit, offset, caseSensitive)
+}
+
+// FindTagsInScope runs a DB search against the tags part of texts
+func FindTagsInScope(scope Scope,
 	query string,
 	limit int,
 	offset int,
 	caseSensitive bool,
 ) ([]Text, error) {
-	return findTextsPartsByUserID("texts.text", userID, query, limit, offset, caseSensitive)
+	return findTextsPartsInScope("texts.tags", scope, query, limit, offset, caseSensitive)
 }
 
-// FindShapesByUserID runs a DB search against the shapes part of texts
-func FindShapesByUserID(userID uint,
+// FindLemmasInScope runs a DB search against the nominatives part of texts
+func FindLemmasInScope(scope Scope,
 	query string,
 	limit int,
 	offset int,
 	caseSensitive bool,
 ) ([]Text, error) {
-	return findTextsPartsByUserID("texts.shapes", userID, query, limit, offset, caseSensitive)
+	return findTextsPartsInScope("texts.lemmas", scope, query, limit, offset, caseSensitive)
 }
 
-// FindTagsByUserID runs a DB search against the tags part of texts
-func FindTagsByUserID(userID uint,
+// FindPartRegexInScope runs a DB regular expression search against a part of texts
+// or its normalized shadow, the pattern is expected to be in Postgres' flavor
+func FindPartRegexInScope(
+	part string,
+	scope Scope,
+	pattern string,
+	limit int,
+	offset int,
+	caseSensitive bool,
+	normalized bool,
+) ([]Text, error) {
+	texts := make([]Text, 0, limit)
+	if _, ok := MapPartToFindFunction[part]; !ok {
+		return texts, errors.New("unknown part of texts")
+	}
+	column := "texts." + part
+	if _, ok := MapNormalizedPartToFindFunction[part]; ok && normalized {
+		column = normalizedColumn(part)
+	}
+	operator := " ~* ?"
+	if caseSensitive {
+		operator = " ~ ?"
+	}
+	err := joinScopedTexts(DB.Model(texts), "texts.id", scope).
+		Where(column+operator, pattern).
+		Order("texts.id").
+		Limit(limit).
+		Offset(offset).
+		Find(&texts).
+		Error
+	return texts, err
+}
+
+// FindNormalizedTextsInScope runs a DB search against the normalized text part of texts
+func FindNormalizedTextsInScope(scope Scope,
 	query string,
 	limit int,
 	offset int,
 	caseSensitive bool,
 ) ([]Text, error) {
-	return findTextsPartsByUserID("texts.tags", userID, query, limit, offset, caseSensitive)
+	return findTextsPartsInScope(normalizedColumn("text"), scope, query, limit, offset, caseSensitive)
 }
 
-// FindLemmasByUserID runs a DB search against the nominatives part of texts
-func FindLemmasByUserID(userID uint,
+// FindNormalizedLemmasInScope runs a DB search against the normalized lemmas part of texts
+func FindNormalizedLemmasInScope(scope Scope,
 	query string,
 	limit int,
 	offset int,
 	caseSensitive bool,
 ) ([]Text, error) {
-	return findTextsPartsByUserID("texts.lemmas", userID, query, limit, offset, caseSensitive)
+	return findTextsPartsInScope(normalizedColumn("lemmas"), scope, query, limit, offset, caseSensitive)
+}
+
+// normalizedColumn is the SQL of a part's normalized shadow, which is only
+// stored if it differs from the part, see normalizeText
+func normalizedColumn(part string) string {
+	return "COALESCE(NULLIF(texts." + part + "_normalized, ''), texts." + part + ")"
 }
 
-// findTextsPartsByUserID is the lower-level-true-SQL fundamental function to seacrh parts of texts
-func findTextsPartsByUserID(
+// findTextsPartsInScope is the lower-level-true-SQL fundamental function to seacrh parts of texts
+func findTextsPartsInScope(
 	part string,
-	userID uint,
+	scope Scope,
 	query string,
 	limit int,
 	offset int,
@@ -68,13 +138,9 @@ func findTextsPartsByUserID(
 		sqlWhere = "lower(" + part + ") LIKE ?"
 		sqlMatch = "%" + strings.ToLower(query) + "%"
 	}
-	err := DB.Model(texts).
-		Joins("INNER JOIN source_texts on texts.id = source_texts.text_id").
-		Joins("INNER JOIN sources on sources.id = source_texts.source_id").
-		Joins("INNER JOIN user_sources on sources.id = user_sources.source_id").
-		Joins("INNER JOIN user_sources_enabled on user_sources.source_id = user_sources_enabled.source_id").
-		Joins("INNER JOIN users on user_sources_enabled.user_id = users.id AND users.id = ?", userID).
+	err := joinScopedTexts(DB.Model(texts), "texts.id", scope).
 		Where(sqlWhere, sqlMatch).
+		Order("texts.id").
 		Limit(limit).
 		Offset(offset).
 		Find(&texts).
@@ -0,0 +1,293 @@
+package storage
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/thecsw/katya/log"
+	"github.com/thecsw/katya/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	// postingsBatchSize is how many postings we insert at a time
+	postingsBatchSize = 1000
+	// reindexBatchSize is how many texts we load at a time during a rebuild
+	reindexBatchSize = 50
+)
+
+var (
+	// IndexedLayers are the text layers that go into the inverted index
+	IndexedLayers = []string{"text", "shapes", "tags", "lemmas"}
+)
+
+// IndexTerm turns a token of a layer into the term we store in the index,
+// everything is lowercased except for shapes, where casing is the point,
+// the orthography of texts and lemmas is normalized on top of that
+func IndexTerm(layer, token string) string {
+	if layer == "shapes" {
+		return token
+	}
+	if _, ok := MapNormalizedPartToFindFunction[layer]; ok {
+		token = utils.NormalizeRussian(token)
+	}
+	return strings.ToLower(token)
+}
+
+// TextLayers maps the indexed layers to the actual layer strings of a text
+func TextLayers(text *Text) map[string]string {
+	return map[string]string{
+		"text":   text.Text,
+		"shapes": text.Shapes,
+		"tags":   text.Tags,
+		"lemmas": text.Lemmas,
+	}
+}
+
+// buildPostings creates all the postings of a text
+func buildPostings(text *Text) []Posting {
+	postings := make([]Posting, 0, 1024)
+	layers := TextLayers(text)
+	for _, layer := range IndexedLayers {
+		positions := make(map[string][]string)
+		terms := make([]string, 0, 256)
+		for i, token := range strings.Split(layers[layer], " ") {
+			if token == "" {
+				continue
+			}
+			term := IndexTerm(layer, token)
+			if _, seen := positions[term]; !seen {
+				terms = append(terms, term)
+			}
+			positions[term] = append(positions[term], strconv.Itoa(i))
+		}
+		for _, term := range terms {
+			postings = append(postings, Posting{
+				Layer:     layer,
+				Term:      term,
+				TextID:    text.ID,
+				Positions: strings.Join(positions[term], " "),
+			})
+		}
+	}
+	return postings
+}
+
+// IndexText (re)creates the inverted index entries of a text
+func IndexText(text *Text) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return indexText(tx, text)
+	})
+}
+
+// indexText is IndexText within the given transaction
+func indexText(tx *gorm.DB, text *Text) error {
+	postings := buildPostings(text)
+	if err := tx.Where("text_id = ?", text.ID).Delete(&Posting{}).Error; err != nil {
+		return errors.Wrap(err, "failed to delete old postings")
+	}
+	if len(postings) == 0 {
+		return nil
+	}
+	if err := tx.CreateInBatches(postings, postingsBatchSize).Error; err != nil {
+		return errors.Wrap(err, "failed to create postings")
+	}
+	return nil
+}
+
+// RebuildIndex reindexes every text we have and fills their normalized
+// shadows on the way, returns the number of texts
+func RebuildIndex() (int, error) {
+	texts := make([]Text, 0, reindexBatchSize)
+	indexed := 0
+	err := DB.Model(&Text{}).FindInBatches(&texts, reindexBatchSize, func(tx *gorm.DB, batch int) error {
+		for i := range texts {
+			normalizeText(&texts[i])
+			err := DB.Model(&texts[i]).Updates(map[string]interface{}{
+				"text_normalized":   texts[i].TextNormalized,
+				"lemmas_normalized": texts[i].LemmasNormalized,
+			}).Error
+			if err != nil {
+				log.Error("failed to normalize a text", err, log.Params{"url": texts[i].URL})
+				return err
+			}
+			if err := IndexText(&texts[i]); err != nil {
+				log.Error("failed to index a text", err, log.Params{"url": texts[i].URL})
+				return err
+			}
+			indexed++
+		}
+		log.Format("Reindexed a batch of texts", log.Params{"batch": batch, "indexed": indexed})
+		return nil
+	}).Error
+	return indexed, err
+}
+
+// FindPhraseStartsInScope resolves a sequence of terms of a layer through
+// the inverted index, it returns the token offsets where the whole sequence
+// starts in every matched text of the scope, keyed by the text ID
+func FindPhraseStartsInScope(layer string, scope Scope, terms []string) (map[uint][]int, error) {
+	variants := make([][]string, len(terms))
+	for i, term := range terms {
+		variants[i] = []string{term}
+	}
+	return FindVariantPhraseStartsInScope(layer, scope, variants)
+}
+
+// FindVariantPhraseStartsInScope is FindPhraseStartsInScope where every
+// position of the sequence can be any of its variant terms
+func FindVariantPhraseStartsInScope(layer string, scope Scope, variants [][]string) (map[uint][]int, error) {
+	if len(variants) == 0 {
+		return nil, errors.New("no terms given")
+	}
+	for _, terms := range variants {
+		if len(terms) == 0 {
+			return map[uint][]int{}, nil
+		}
+	}
+	order, err := rarestPositions(layer, variants)
+	if err != nil {
+		return nil, err
+	}
+	var starts map[uint][]int
+	// texts is the subquery of the texts that have all the positions so far
+	var texts *gorm.DB
+	for _, k := range order {
+		postings := make([]Posting, 0, 64)
+		tx := joinScopedTexts(DB.Model(postings), "postings.text_id", scope).
+			Where("postings.layer = ? AND postings.term IN ?", layer, variants[k])
+		// Every next term only needs to be looked up in the texts we still have
+		if texts != nil {
+			tx = tx.Where("postings.text_id IN (?)", texts)
+		}
+		if err := tx.Find(&postings).Error; err != nil {
+			return nil, err
+		}
+		having := DB.Model(&Posting{}).
+			Select("text_id").
+			Where("layer = ? AND term IN ?", layer, variants[k])
+		if texts != nil {
+			having = having.Where("text_id IN (?)", texts)
+		}
+		texts = having
+		// The same text can come from multiple enabled sources, or match
+		// multiple variants, so put all of its positions together
+		present := make(map[uint]map[int]bool, len(postings))
+		for _, posting := range postings {
+			if present[posting.TextID] == nil {
+				present[posting.TextID] = make(map[int]bool)
+			}
+			for _, position := range parsePositions(posting.Positions) {
+				present[posting.TextID][position] = true
+			}
+		}
+		next := make(map[uint][]int, len(present))
+		for textID, positions := range present {
+			if starts == nil {
+				// The sequence starts k tokens before the rarest term
+				sorted := make([]int, 0, len(positions))
+				for position := range positions {
+					if position >= k {
+						sorted = append(sorted, position-k)
+					}
+				}
+				sort.Ints(sorted)
+				if len(sorted) > 0 {
+					next[textID] = sorted
+				}
+				continue
+			}
+			// Only keep the starts that have this term right k tokens after
+			kept := make([]int, 0, len(starts[textID]))
+			for _, start := range starts[textID] {
+				if positions[start+k] {
+					kept = append(kept, start)
+				}
+			}
+			if len(kept) > 0 {
+				next[textID] = kept
+			}
+		}
+		starts = next
+		if len(starts) == 0 {
+			break
+		}
+	}
+	return starts, nil
+}
+
+// rarestPositions returns the positions of the sequence from the one with
+// the fewest postings, so we load as little as possible before intersecting
+func rarestPositions(layer string, variants [][]string) ([]int, error) {
+	counts := make([]int64, len(variants))
+	order := make([]int, len(variants))
+	for k, terms := range variants {
+		order[k] = k
+		err := DB.Model(&Posting{}).
+			Where("layer = ? AND term IN ?", layer, terms).
+			Count(&counts[k]).
+			Error
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to count postings")
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool { return counts[order[i]] < counts[order[j]] })
+	return order, nil
+}
+
+// GetTextsByIDs returns the texts with given IDs ordered by their IDs
+func GetTextsByIDs(textIDs []uint) ([]Text, error) {
+	texts := make([]Text, 0, len(textIDs))
+	if len(textIDs) == 0 {
+		return texts, nil
+	}
+	err := DB.Where("id IN ?", textIDs).Order("id").Find(&texts).Error
+	return texts, err
+}
+
+// SourceText is a single link between a source and a text
+type SourceText struct {
+	SourceID uint
+	TextID   uint
+}
+
+// GetTextsSourcesInScope returns the links of the given texts to the
+// sources of the scope, a text can be linked to multiple sources
+func GetTextsSourcesInScope(scope Scope, textIDs []uint) ([]SourceText, error) {
+	links := make([]SourceText, 0, len(textIDs))
+	if len(textIDs) == 0 {
+		return links, nil
+	}
+	err := joinScopedTexts(DB.Table("texts"), "texts.id", scope).
+		Select("source_texts.source_id, source_texts.text_id").
+		Where("texts.id IN ?", textIDs).
+		Scan(&links).
+		Error
+	return links, err
+}
+
+// parsePositions parses the space-separated positions of a posting
+func parsePositions(positions string) []int {
+	fields := strings.Fields(positions)
+	result := make([]int, 0, len(fields))
+	for _, field := range fields {
+		position, err := strconv.Atoi(field)
+		if err != nil {
+			continue
+		}
+		result = append(result, position)
+	}
+	return result
+}
+
+// SortedTextIDs returns the sorted text IDs of a starts map
+func SortedTextIDs(starts map[uint][]int) []uint {
+	keys := make([]uint, 0, len(starts))
+	for k := range starts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
@@ -54,6 +54,21 @@ type Source struct {
 	Crawling bool `gorm:"-" json:"crawling"`
 }
 
+// Subcorpus struct is a named collection of a user's sources, like
+// "19th-century prose", so queries can be scoped to it by its name.
+type Subcorpus struct {
+	gorm.Model `json:"-"`
+
+	// UserID is the ID of the user that owns the subcorpus
+	UserID uint `json:"-" gorm:"uniqueIndex:idx_subcorpus_user_name"`
+	// Name is the user-given name, unique for every user
+	Name string `json:"name" gorm:"uniqueIndex:idx_subcorpus_user_name"`
+
+	// A subcorpus has multiple sources and a source can be
+	// in multiple subcorpora (of multiple users)
+	Sources []*Source `gorm:"many2many:subcorpus_sources;" json:"sources"`
+}
+
 // Crawler struct defines the crawlers that we have, with the starting
 // link they're using and the user that created this crawler.
 type Crawler struct {
@@ -114,14 +129,55 @@ type Text struct {
 	Tags string `json:"tags"`
 	// Lemmas is the tokenized text of nominatives from SpaCy
 	Lemmas string `json:"lemmas"`
+	// TextNormalized is the Text with normalized orthography for searches,
+	// empty if it's the same as the Text
+	TextNormalized string `json:"-"`
+	// LemmasNormalized is the Lemmas with normalized orthography for
+	// searches, empty if it's the same as the Lemmas
+	LemmasNormalized string `json:"-"`
 	// Title is the title of the HTML webpage (extracted)
 	Title string `json:"title"`
 	// NumWords is the number of words (no punct) of the Text
 	NumWords uint `json:"num_words"`
 	// NumWords is the number of sentences of the Text
 	NumSentences uint `json:"num_sentences"`
+	// Sentences are the space-separated token offsets where the sentences start
+	Sentences string `json:"sentences"`
 
 	// Text can be associated with multiple sources and a source
 	// can be associated with many texts
 	Sources []*Source `gorm:"many2many:source_texts;" json:"-"`
 }
+
+// Posting struct is a single entry of the positional inverted index, it
+// maps a term of a text layer (text, shapes, tags or lemmas) to all the token
+// offsets it occurs at in a text. It doesn't embed gorm.Model, as postings
+// are only ever rewritten as a whole together with their text.
+type Posting struct {
+	ID uint `gorm:"primarykey" json:"-"`
+
+	// Layer is the text layer the term is taken from
+	Layer string `json:"layer" gorm:"index:idx_postings_layer_term"`
+	// Term is the indexed token, see IndexTerm
+	Term string `json:"term" gorm:"index:idx_postings_layer_term"`
+	// TextID is the text where the term occurs
+	TextID uint `json:"text_id" gorm:"index"`
+	// Positions is the space-separated list of the term's token offsets
+	Positions string `json:"positions"`
+}
+
+// Vocabulary struct is how many times a term of a layer (text or lemmas)
+// occurs in a source, it's kept up to date as texts come in, so lookups
+// like autocompletion don't have to go through the texts themselves.
+type Vocabulary struct {
+	ID uint `gorm:"primarykey" json:"-"`
+
+	// SourceID is the source the term occurs in
+	SourceID uint `json:"-" gorm:"uniqueIndex:idx_vocabulary_entry"`
+	// Layer is the text layer the term is taken from
+	Layer string `json:"-" gorm:"uniqueIndex:idx_vocabulary_entry;index:idx_vocabulary_layer_term"`
+	// Term is the token as it is stored in the index, see IndexTerm
+	Term string `json:"term" gorm:"uniqueIndex:idx_vocabulary_entry;index:idx_vocabulary_layer_term"`
+	// Count is the number of the term's occurrences in the source
+	Count uint `json:"count"`
+}
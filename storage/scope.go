@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Scope narrows down the texts of a user for a single request, so one
+// query can look at some sources without enabling or disabling them
+type Scope struct {
+	// UserID is the user whose sources are searched
+	UserID uint
+	// Sources are the IDs of the user's sources to search, all the
+	// enabled sources of the user are searched if it's empty
+	Sources []uint
+	// Exclude are the IDs of the sources to leave out
+	Exclude []uint
+	// From only keeps the texts created at or after it, if not zero
+	From time.Time
+	// To only keeps the texts created before it, if not zero
+	To time.Time
+}
+
+// joinScopedTexts joins the texts referenced by textColumn with the sources
+// of the scope, so only the texts the scope allows are matched
+func joinScopedTexts(tx *gorm.DB, textColumn string, scope Scope) *gorm.DB {
+	tx = joinScopedSources(tx.
+		Joins("INNER JOIN source_texts on "+textColumn+" = source_texts.text_id").
+		Joins("INNER JOIN sources on sources.id = source_texts.source_id"), "sources.id", scope)
+	if scope.From.IsZero() && scope.To.IsZero() {
+		return tx
+	}
+	// Postings and other tables only reference texts, so get their dates
+	dated := "texts"
+	if textColumn != "texts.id" {
+		dated = "scoped_texts"
+		tx = tx.Joins("INNER JOIN texts scoped_texts on scoped_texts.id = " + textColumn)
+	}
+	if !scope.From.IsZero() {
+		tx = tx.Where(dated+".created_at >= ?", scope.From)
+	}
+	if !scope.To.IsZero() {
+		tx = tx.Where(dated+".created_at < ?", scope.To)
+	}
+	return tx
+}
+
+// GetScopeSources returns the sources that the scope searches
+func GetScopeSources(scope Scope) ([]Source, error) {
+	sources := make([]Source, 0, 16)
+	err := joinScopedSources(DB.Model(sources), "sources.id", scope).Find(&sources).Error
+	return sources, err
+}
+
+// joinScopedSources joins the sources referenced by sourceColumn with the
+// user's sources, so only the sources the scope allows are matched, the
+// dates of the scope are left to the texts
+func joinScopedSources(tx *gorm.DB, sourceColumn string, scope Scope) *gorm.DB {
+	if len(scope.Sources) > 0 {
+		// Explicitly given sources only have to belong to the user, enabled or not
+		tx = tx.
+			Joins("INNER JOIN user_sources on "+sourceColumn+" = user_sources.source_id AND user_sources.user_id = ?", scope.UserID).
+			Where(sourceColumn+" IN ?", scope.Sources)
+	} else {
+		tx = tx.
+			Joins("INNER JOIN user_sources_enabled on "+sourceColumn+" = user_sources_enabled.source_id AND user_sources_enabled.user_id = ?", scope.UserID)
+	}
+	if len(scope.Exclude) > 0 {
+		tx = tx.Where(sourceColumn+" NOT IN ?", scope.Exclude)
+	}
+	return tx
+}
+
+// WalkScopedTexts goes through all the texts of the scope in batches ordered
+// by their IDs, a text linked to multiple sources of the scope comes only once
+func WalkScopedTexts(scope Scope, batchSize int, fn func(texts []Text) error) error {
+	textIDs := joinScopedTexts(DB.Table("texts"), "texts.id", scope).Select("texts.id")
+	texts := make([]Text, 0, batchSize)
+	return DB.Model(&Text{}).
+		Where("id IN (?)", textIDs).
+		FindInBatches(&texts, batchSize, func(tx *gorm.DB, batch int) error {
+			return fn(texts)
+		}).
+		Error
+}
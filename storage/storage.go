@@ -30,7 +30,7 @@ func InitDB(dsn string) error {
 	if err != nil {
 		return err
 	}
-	err = DB.AutoMigrate(&User{}, &Source{}, &Crawler{}, &Scrape{}, &Global{}, &Text{})
+	err = DB.AutoMigrate(&User{}, &Source{}, &Crawler{}, &Scrape{}, &Global{}, &Text{}, &Posting{}, &Subcorpus{}, &Vocabulary{})
 	if err != nil {
 		log.Error("Failed to automatically migrate gorm tables!", err, log.Params{"DSN": dsn})
 		return err
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"github.com/thecsw/katya/log"
+	"gorm.io/gorm"
+)
+
+// CreateSubcorpus creates a subcorpus for a user or replaces
+// the sources of the user's subcorpus with the same name
+func CreateSubcorpus(userID uint, name string, sourceIDs []uint) error {
+	sources := make([]*Source, len(sourceIDs))
+	for i, id := range sourceIDs {
+		sources[i] = &Source{}
+		sources[i].ID = id
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		subcorpus := &Subcorpus{}
+		err := tx.Where(Subcorpus{UserID: userID, Name: name}).FirstOrCreate(subcorpus).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(subcorpus).Association("Sources").Replace(sources)
+	})
+	if err != nil {
+		log.Error("Failed to create a subcorpus", err, log.Params{"user": userID, "name": name})
+		return err
+	}
+	log.Format("Successfully saved a subcorpus", log.Params{"user": userID, "name": name})
+	return nil
+}
+
+// GetSubcorpus returns the user's subcorpus with its sources
+func GetSubcorpus(userID uint, name string) (*Subcorpus, error) {
+	subcorpus := &Subcorpus{}
+	err := DB.Preload("Sources").
+		Where("user_id = ? AND name = ?", userID, name).
+		First(subcorpus).
+		Error
+	return subcorpus, err
+}
+
+// GetSubcorpora returns all the subcorpora of a user with their sources
+func GetSubcorpora(userID uint) ([]Subcorpus, error) {
+	subcorpora := make([]Subcorpus, 0, 8)
+	err := DB.Preload("Sources").
+		Where("user_id = ?", userID).
+		Order("name").
+		Find(&subcorpora).
+		Error
+	return subcorpora, err
+}
+
+// DeleteSubcorpus deletes the user's subcorpus, the sources stay intact
+func DeleteSubcorpus(userID uint, name string) error {
+	subcorpus, err := GetSubcorpus(userID, name)
+	if err != nil {
+		return err
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(subcorpus).Association("Sources").Clear(); err != nil {
+			return err
+		}
+		// Deleted for real, so the name can be taken again
+		return tx.Unscoped().Delete(subcorpus).Error
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/patrickmn/go-cache"
 	"github.com/pkg/errors"
 	"github.com/thecsw/katya/log"
+	"github.com/thecsw/katya/utils"
 	"gorm.io/gorm"
 )
 
@@ -13,6 +14,14 @@ const (
 	duplicateKeyViolatedError = "duplicate key value violates unique constraint"
 )
 
+var (
+	// sentenceEnds are the tokens that end a sentence in the texts that
+	// came without their sentence boundaries
+	sentenceEnds = map[string]bool{
+		".": true, "!": true, "?": true, "…": true, "...": true,
+	}
+)
+
 // CreateText creates a full text that we receive from our scrapers
 func CreateText(
 	source string,
@@ -27,6 +36,7 @@ func CreateText(
 	title string,
 	numWords uint,
 	numSentences uint,
+	sentences string,
 ) error {
 	textFound, err := GetText(url, false)
 	if err != nil && err != gorm.ErrRecordNotFound {
@@ -49,11 +59,20 @@ func CreateText(
 			Title:        title,
 			NumWords:     numWords,
 			NumSentences: numSentences,
+			Sentences:    sentences,
 		}
-		err = DB.Create(toAdd).Error
+		normalizeText(toAdd)
+		// Put the new text into the inverted index for searches right away,
+		// a text that isn't indexed would never be found, so don't keep it
+		err = DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(toAdd).Error; err != nil {
+				return errors.Wrap(err, "failed to create a new text")
+			}
+			return errors.Wrap(indexText(tx, toAdd), "failed to index a new text")
+		})
 		if err != nil {
 			log.Error("failed to create a new text", err, log.Params{"url": url})
-			return errors.Wrap(err, "failed to create a new text")
+			return err
 		}
 		textFound.ID = toAdd.ID
 	}
@@ -75,6 +94,21 @@ func CreateText(
 		}
 
 	}
+	// Every newly linked text adds up to the vocabulary of the source
+	if !alreadyLinkedToSource {
+		if alreadyExisted {
+			toAdd, err = GetText(url, true)
+			if err != nil {
+				log.Error("failed to get the text for the vocabulary", err, log.Params{"url": url})
+				return errors.Wrap(err, "failed to get the text for the vocabulary")
+			}
+		}
+		err = AddToVocabulary(sourceObj.ID, toAdd)
+		if err != nil {
+			log.Error("failed to add the text to the vocabulary", err, log.Params{"url": url, "source": source})
+			return errors.Wrap(err, "failed to add the text to the vocabulary")
+		}
+	}
 	log.Format("Successfully created a new text", log.Params{
 		"url":             url,
 		"title":           title,
@@ -121,7 +155,65 @@ func TextConnectSource(sourceID, textID uint) error {
 	return DB.Exec("INSERT into source_texts (source_id, text_id) values (?, ?)", sourceID, textID).Error
 }
 
-// UpdateText updates the text
+// UpdateText updates the text, reindexes it and moves the vocabularies of
+// its sources from the stored version of the text to the new one
 func UpdateText(text *Text) error {
-	return DB.Save(text).Error
+	stored := &Text{}
+	if err := DB.Preload("Sources").First(stored, text.ID).Error; err != nil {
+		return errors.Wrap(err, "failed to get the stored text")
+	}
+	normalizeText(text)
+	if err := DB.Save(text).Error; err != nil {
+		return err
+	}
+	if err := IndexText(text); err != nil {
+		return err
+	}
+	sourceIDs := make([]uint, len(stored.Sources))
+	for i, source := range stored.Sources {
+		sourceIDs[i] = source.ID
+	}
+	return ReplaceInVocabulary(sourceIDs, stored, text)
+}
+
+// normalizeText fills the normalized shadows of the text's searchable parts,
+// see utils.NormalizeRussian, the shadows stay aligned with the original and
+// are left empty if normalizing changes nothing, which is the most of texts
+func normalizeText(text *Text) {
+	text.TextNormalized = normalizedShadow(text.Text)
+	text.LemmasNormalized = normalizedShadow(text.Lemmas)
+}
+
+// normalizedShadow returns the normalized part or nothing if it's the same
+func normalizedShadow(part string) string {
+	if normalized := utils.NormalizeRussian(part); normalized != part {
+		return normalized
+	}
+	return ""
+}
+
+// SentenceIDs returns the number of the sentence every token of the text
+// belongs to, the texts stored before the sentence boundaries were sent
+// are split after the sentence-ending punctuation instead
+func SentenceIDs(text *Text, tokens []string) []int {
+	ids := make([]int, len(tokens))
+	if text.Sentences != "" {
+		starts := parsePositions(text.Sentences)
+		sentence := -1
+		for i := range tokens {
+			for sentence+1 < len(starts) && starts[sentence+1] <= i {
+				sentence++
+			}
+			ids[i] = utils.Max(0, sentence)
+		}
+		return ids
+	}
+	sentence := 0
+	for i, token := range tokens {
+		ids[i] = sentence
+		if sentenceEnds[token] {
+			sentence++
+		}
+	}
+	return ids
 }
@@ -0,0 +1,229 @@
+package storage
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/thecsw/katya/log"
+	"github.com/thecsw/katya/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// vocabularyBatchSize is how many vocabulary entries we upsert at a time
+	vocabularyBatchSize = 1000
+)
+
+var (
+	// likeEscaper escapes the LIKE wildcards of a term
+	likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+	// VocabularyLayers are the text layers that we keep the vocabulary of
+	VocabularyLayers = []string{"text", "lemmas"}
+)
+
+// vocabularyKey is a single entry of the vocabulary before it's stored
+type vocabularyKey struct {
+	sourceID uint
+	layer    string
+	term     string
+}
+
+// countVocabulary adds the terms of the text's vocabulary layers to counts
+func countVocabulary(counts map[vocabularyKey]uint, sourceID uint, text *Text) {
+	layers := TextLayers(text)
+	for _, layer := range VocabularyLayers {
+		for _, token := range strings.Split(layers[layer], " ") {
+			if token == "" {
+				continue
+			}
+			counts[vocabularyKey{sourceID, layer, IndexTerm(layer, token)}]++
+		}
+	}
+}
+
+// upsertVocabulary adds the counts to the stored vocabulary, the entries that
+// are already there just get their counts increased
+func upsertVocabulary(counts map[vocabularyKey]uint) error {
+	if len(counts) == 0 {
+		return nil
+	}
+	entries := make([]Vocabulary, 0, len(counts))
+	for k, v := range counts {
+		entries = append(entries, Vocabulary{SourceID: k.sourceID, Layer: k.layer, Term: k.term, Count: v})
+	}
+	return DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "source_id"}, {Name: "layer"}, {Name: "term"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"count": gorm.Expr("vocabularies.count + excluded.count"),
+		}),
+	}).CreateInBatches(entries, vocabularyBatchSize).Error
+}
+
+// AddToVocabulary counts the terms of a text into the vocabulary of a source
+func AddToVocabulary(sourceID uint, text *Text) error {
+	counts := make(map[vocabularyKey]uint)
+	countVocabulary(counts, sourceID, text)
+	return upsertVocabulary(counts)
+}
+
+// ReplaceInVocabulary swaps the terms of the old version of a text for the
+// updated ones in the vocabularies of the text's sources, the entries that
+// aren't in any text of a source anymore are deleted
+func ReplaceInVocabulary(sourceIDs []uint, old, updated *Text) error {
+	oldCounts := make(map[vocabularyKey]uint)
+	newCounts := make(map[vocabularyKey]uint)
+	for _, sourceID := range sourceIDs {
+		countVocabulary(oldCounts, sourceID, old)
+		countVocabulary(newCounts, sourceID, updated)
+	}
+	added := make(map[vocabularyKey]uint)
+	removed := make(map[vocabularyKey]uint)
+	for k, v := range newCounts {
+		if v > oldCounts[k] {
+			added[k] = v - oldCounts[k]
+		}
+	}
+	for k, v := range oldCounts {
+		if v > newCounts[k] {
+			removed[k] = v - newCounts[k]
+		}
+	}
+	if err := upsertVocabulary(added); err != nil {
+		return errors.Wrap(err, "failed to add the new terms")
+	}
+	return errors.Wrap(subtractVocabulary(removed), "failed to subtract the old terms")
+}
+
+// subtractVocabulary takes the counts away from the stored vocabulary and
+// deletes the entries that are down to zero
+func subtractVocabulary(counts map[vocabularyKey]uint) error {
+	rows := make([]string, 0, vocabularyBatchSize)
+	args := make([]interface{}, 0, 4*vocabularyBatchSize)
+	flush := func() error {
+		if len(rows) == 0 {
+			return nil
+		}
+		values := strings.Join(rows, ", ")
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			err := tx.Exec("UPDATE vocabularies SET count = vocabularies.count - removed.count "+
+				"FROM (VALUES "+values+") AS removed (source_id, layer, term, count) "+
+				"WHERE vocabularies.source_id = removed.source_id AND vocabularies.layer = removed.layer "+
+				"AND vocabularies.term = removed.term", args...).Error
+			if err != nil {
+				return err
+			}
+			return tx.Exec("DELETE FROM vocabularies USING (VALUES "+values+") AS removed (source_id, layer, term, count) "+
+				"WHERE vocabularies.source_id = removed.source_id AND vocabularies.layer = removed.layer "+
+				"AND vocabularies.term = removed.term AND vocabularies.count <= 0", args...).Error
+		})
+		rows, args = rows[:0], args[:0]
+		return err
+	}
+	for k, v := range counts {
+		rows = append(rows, "(?::bigint, ?::text, ?::text, ?::bigint)")
+		args = append(args, k.sourceID, k.layer, k.term, v)
+		if len(rows) == vocabularyBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
+
+// RebuildVocabulary recounts the vocabularies of all sources from scratch,
+// returns the number of texts counted
+func RebuildVocabulary() (int, error) {
+	if err := DB.Where("1 = 1").Delete(&Vocabulary{}).Error; err != nil {
+		return 0, errors.Wrap(err, "failed to clear the vocabulary")
+	}
+	texts := make([]Text, 0, reindexBatchSize)
+	counted := 0
+	err := DB.Model(&Text{}).Preload("Sources").FindInBatches(&texts, reindexBatchSize, func(tx *gorm.DB, batch int) error {
+		counts := make(map[vocabularyKey]uint)
+		for i := range texts {
+			for _, source := range texts[i].Sources {
+				countVocabulary(counts, source.ID, &texts[i])
+			}
+			counted++
+		}
+		if err := upsertVocabulary(counts); err != nil {
+			return err
+		}
+		log.Format("Recounted a batch of texts", log.Params{"batch": batch, "counted": counted})
+		return nil
+	}).Error
+	return counted, err
+}
+
+// scopedVocabulary starts a query that sums up the vocabularies of the
+// scope's sources for a layer, the dates of the scope are not taken into
+// account, as the vocabulary doesn't know about single texts
+func scopedVocabulary(scope Scope, layer string) *gorm.DB {
+	return joinScopedSources(DB.Model(&Vocabulary{}), "vocabularies.source_id", scope).
+		Select("vocabularies.term, SUM(vocabularies.count) AS count").
+		Where("vocabularies.layer = ?", layer).
+		Group("vocabularies.term")
+}
+
+// FindVocabularyByPrefix returns the most frequent terms of a layer that
+// start with the prefix, which is turned into a term first, see IndexTerm
+func FindVocabularyByPrefix(scope Scope, layer, prefix string, limit int) ([]Vocabulary, error) {
+	entries := make([]Vocabulary, 0, limit)
+	escaped := likeEscaper.Replace(IndexTerm(layer, prefix))
+	err := scopedVocabulary(scope, layer).
+		Where("vocabularies.term LIKE ?", escaped+"%").
+		Order("count DESC, vocabularies.term").
+		Limit(limit).
+		Scan(&entries).
+		Error
+	return entries, err
+}
+
+// FindVocabularyCounts returns the counts of the given terms of a layer,
+// the terms that never occur are left out
+func FindVocabularyCounts(scope Scope, layer string, terms []string) (map[string]uint, error) {
+	counts := make(map[string]uint, len(terms))
+	if len(terms) == 0 {
+		return counts, nil
+	}
+	entries := make([]Vocabulary, 0, len(terms))
+	err := scopedVocabulary(scope, layer).
+		Where("vocabularies.term IN ?", terms).
+		Scan(&entries).
+		Error
+	for _, v := range entries {
+		counts[v.Term] = v.Count
+	}
+	return counts, err
+}
+
+// FindVocabularyCandidates returns the terms of a layer that could be within
+// maxDistance edits of the term, which is everything of a close enough length
+// that has one of its edit pieces (see utils.EditPieces) intact, so no close
+// term is left out, the most frequent ones come first
+func FindVocabularyCandidates(scope Scope, layer, term string, maxDistance int) ([]Vocabulary, error) {
+	entries := make([]Vocabulary, 0)
+	runes := []rune(term)
+	if len(runes) == 0 {
+		return entries, nil
+	}
+	tx := scopedVocabulary(scope, layer).
+		Where("char_length(vocabularies.term) BETWEEN ? AND ?", len(runes)-maxDistance, len(runes)+maxDistance)
+	if pieces := utils.EditPieces(term, maxDistance); len(pieces) > 0 {
+		conditions := make([]string, len(pieces))
+		args := make([]interface{}, len(pieces))
+		for i, piece := range pieces {
+			conditions[i] = "vocabularies.term LIKE ?"
+			args[i] = "%" + likeEscaper.Replace(piece) + "%"
+		}
+		tx = tx.Where("("+strings.Join(conditions, " OR ")+")", args...)
+	}
+	err := tx.
+		Order("count DESC, vocabularies.term").
+		Scan(&entries).
+		Error
+	return entries, err
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/thecsw/katya/log"
+	"github.com/thecsw/katya/storage"
+	"gorm.io/gorm"
+)
+
+// subcorpusPayload is the payload to create, update or delete a subcorpus
+type subcorpusPayload struct {
+	// Name is the user-given name of the subcorpus
+	Name string `json:"name"`
+	// Sources are the links or IDs of the user's sources in it
+	Sources []string `json:"sources"`
+}
+
+// userGetSubcorpora is an API endpoint to return user's subcorpora
+func userGetSubcorpora(w http.ResponseWriter, r *http.Request) {
+	user := r.Context().Value(ContextKey("user")).(storage.User)
+	subcorpora, err := storage.GetSubcorpora(user.ID)
+	if err != nil {
+		httpJSON(w, nil, http.StatusInternalServerError, errors.Wrap(err, "failed to retrieve subcorpora"))
+		return
+	}
+	httpJSON(w, subcorpora, http.StatusOK, nil)
+}
+
+// userCreateSubcorpus is an API endpoint to create a subcorpus for a user,
+// a subcorpus with the same name gets its sources replaced
+func userCreateSubcorpus(w http.ResponseWriter, r *http.Request) {
+	payload := &subcorpusPayload{}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(payload)
+	if err != nil {
+		log.Error("Failed decoding a create subcorpus payload", err, nil)
+		httpJSON(w, nil, http.StatusBadRequest, errors.Wrap(err, "bad request payload"))
+		return
+	}
+	payload.Name = strings.TrimSpace(payload.Name)
+	if payload.Name == "" {
+		httpJSON(w, nil, http.StatusBadRequest, errors.New("received empty name"))
+		return
+	}
+	user := r.Context().Value(ContextKey("user")).(storage.User)
+	owned, err := storage.GetUserSources(user.Name)
+	if err != nil {
+		httpJSON(w, nil, http.StatusInternalServerError, errors.Wrap(err, "failed to retrieve sources"))
+		return
+	}
+	sourceIDs, err := resolveSources(payload.Sources, owned)
+	if err != nil {
+		httpJSON(w, nil, http.StatusBadRequest, err)
+		return
+	}
+	if len(sourceIDs) == 0 {
+		httpJSON(w, nil, http.StatusBadRequest, errors.New("a subcorpus needs at least one source"))
+		return
+	}
+	err = storage.CreateSubcorpus(user.ID, payload.Name, sourceIDs)
+	if err != nil {
+		httpJSON(w, nil, http.StatusInternalServerError, errors.Wrap(err, "failed to save subcorpus"))
+		return
+	}
+	httpJSON(w, httpMessageReturn{"subcorpus saved: " + payload.Name}, http.StatusOK, nil)
+}
+
+// userDeleteSubcorpus is an API endpoint to delete a subcorpus of a user
+func userDeleteSubcorpus(w http.ResponseWriter, r *http.Request) {
+	payload := &subcorpusPayload{}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(payload)
+	if err != nil {
+		log.Error("Failed decoding a delete subcorpus payload", err, nil)
+		httpJSON(w, nil, http.StatusBadRequest, errors.Wrap(err, "bad request payload"))
+		return
+	}
+	user := r.Context().Value(ContextKey("user")).(storage.User)
+	err = storage.DeleteSubcorpus(user.ID, strings.TrimSpace(payload.Name))
+	if err == gorm.ErrRecordNotFound {
+		httpJSON(w, nil, http.StatusNotFound, errors.New("subcorpus not found"))
+		return
+	}
+	if err != nil {
+		httpJSON(w, nil, http.StatusInternalServerError, errors.Wrap(err, "failed to delete subcorpus"))
+		return
+	}
+	httpJSON(w, httpMessageReturn{"subcorpus deleted"}, http.StatusOK, nil)
+}
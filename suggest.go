@@ -0,0 +1,128 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/thecsw/katya/analysis"
+	"github.com/thecsw/katya/log"
+	"github.com/thecsw/katya/storage"
+)
+
+const (
+	// defaultAutocompleteLimit is how many completions we return by default
+	defaultAutocompleteLimit = 10
+	// maxAutocompleteLimit is the most completions one can ask for
+	maxAutocompleteLimit = 100
+	// didYouMeanHeader carries the suggested query of an empty /find page
+	didYouMeanHeader = "X-Did-You-Mean"
+)
+
+// autocomplete returns the most frequent terms of the layer (text by default,
+// or lemmas) that start with the prefix in the given sources, see newScope,
+// they come from the vocabulary, so the dates of the scope are ignored
+func autocomplete(w http.ResponseWriter, r *http.Request) {
+	// grab the user context from the middleware
+	user := r.Context().Value(ContextKey("user")).(storage.User)
+	scope, err := newScope(r, user)
+	if err != nil {
+		httpJSON(w, nil, http.StatusBadRequest, err)
+		return
+	}
+	layer, err := vocabularyLayer(r)
+	if err != nil {
+		httpJSON(w, nil, http.StatusBadRequest, err)
+		return
+	}
+	prefix := r.URL.Query().Get("prefix")
+	if prefix == "" {
+		httpJSON(w, nil, http.StatusBadRequest, errors.New("bad prefix"))
+		return
+	}
+	limit := defaultAutocompleteLimit
+	if limitT := r.URL.Query().Get("limit"); limitT != "" {
+		limit, err = strconv.Atoi(limitT)
+		if err != nil || limit < 1 || limit > maxAutocompleteLimit {
+			httpJSON(w, nil, http.StatusBadRequest, errors.New("bad limit"))
+			return
+		}
+	}
+	result, err := storage.FindVocabularyByPrefix(scope, layer, prefix, limit)
+	if err != nil {
+		httpJSON(w, nil, http.StatusInternalServerError, errors.Wrap(err, "failed to complete the prefix"))
+		return
+	}
+	httpJSON(w, result, http.StatusOK, nil)
+}
+
+// didYouMean suggests the close spellings of the query's tokens that are not
+// in the vocabulary of the layer (text by default, or lemmas), it's meant for
+// the /find queries that came back without a single hit
+func didYouMean(w http.ResponseWriter, r *http.Request) {
+	// grab the user context from the middleware
+	user := r.Context().Value(ContextKey("user")).(storage.User)
+	scope, err := newScope(r, user)
+	if err != nil {
+		httpJSON(w, nil, http.StatusBadRequest, err)
+		return
+	}
+	layer, err := vocabularyLayer(r)
+	if err != nil {
+		httpJSON(w, nil, http.StatusBadRequest, err)
+		return
+	}
+	query := r.URL.Query().Get("query")
+	if query == "" {
+		httpJSON(w, nil, http.StatusBadRequest, errors.New("bad query"))
+		return
+	}
+	result, err := analysis.FindSpellings(scope, layer, query, analysis.MaxSpellingDistance)
+	if err != nil {
+		httpJSON(w, nil, http.StatusInternalServerError, errors.Wrap(err, "failed to find spellings"))
+		return
+	}
+	httpJSON(w, result, http.StatusOK, nil)
+}
+
+// vocabularyLayer reads the layer= parameter, which has to be one of the
+// layers we keep the vocabulary of, text is the default
+func vocabularyLayer(r *http.Request) (string, error) {
+	layer := r.URL.Query().Get("layer")
+	if layer == "" {
+		return "text", nil
+	}
+	if !isVocabularyLayer(layer) {
+		return "", errors.New("bad layer")
+	}
+	return layer, nil
+}
+
+// isVocabularyLayer tells whether we keep the vocabulary of the layer
+func isVocabularyLayer(layer string) bool {
+	for _, v := range storage.VocabularyLayers {
+		if layer == v {
+			return true
+		}
+	}
+	return false
+}
+
+// suggestQuery sets the did you mean header with the suggested spelling of
+// a plain word or lemma query that found nothing, so clients don't need to
+// call /didyoumean after every empty /find, failures only get logged
+func suggestQuery(w http.ResponseWriter, finder *hitFinder) {
+	if finder.cql != nil || finder.boolean != nil || finder.regex != nil ||
+		finder.substring || finder.fuzzy > 0 || !isVocabularyLayer(finder.part) {
+		return
+	}
+	result, err := analysis.FindSpellings(finder.scope, finder.part, finder.query, analysis.MaxSpellingDistance)
+	if err != nil {
+		log.Error("Failed to suggest a spelling", err, log.Params{"query": finder.query})
+		return
+	}
+	if result.Suggestion != "" {
+		w.Header().Set(didYouMeanHeader, url.QueryEscape(result.Suggestion))
+	}
+}
@@ -29,6 +29,8 @@ type TextPayload struct {
 	NumWords int `json:"num_words"`
 	// NumSentences is the number of sentences in this source
 	NumSentences int `json:"num_sentences"`
+	// Sentences are the space-separated token offsets of the sentence starts
+	Sentences string `json:"sentences"`
 	// Original is the cleaned text crawler worked out
 	Original string `json:"original"`
 	// Text is the tokenized cleaned text SpaCy gave us
@@ -94,6 +96,7 @@ func textReceiver(w http.ResponseWriter, r *http.Request) {
 		payload.Title,
 		uint(payload.NumWords),
 		uint(payload.NumSentences),
+		payload.Sentences,
 	)
 
 	if err != nil {
@@ -0,0 +1,63 @@
+package utils
+
+// EditDistance returns the number of single rune edits that turn a into b,
+// with transpositions of adjacent runes counted as a single edit too if
+// asked (optimal string alignment), anything over max is returned as max+1
+func EditDistance(a, b string, max int, transpositions bool) int {
+	ra, rb := []rune(a), []rune(b)
+	if d := len(ra) - len(rb); d > max || -d > max {
+		return max + 1
+	}
+	// We only need the last two rows, plus the one before for transpositions
+	previous2 := make([]int, len(rb)+1)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		rowMin := current[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = Min(Min(previous[j]+1, current[j-1]+1), previous[j-1]+cost)
+			if transpositions && i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				current[j] = Min(current[j], previous2[j-2]+1)
+			}
+			rowMin = Min(rowMin, current[j])
+		}
+		// No row can get better than the previous one, so give up early
+		if rowMin > max {
+			return max + 1
+		}
+		previous2, previous, current = previous, current, previous2
+	}
+	return Min(previous[len(rb)], max+1)
+}
+
+// EditPieces splits the term into 2*max+1 consecutive pieces, any string at
+// most max edits away from the term, transpositions included, still has one
+// of them intact, as a single edit can only break up to two pieces, it
+// returns nil if the term is too short to have that many pieces
+func EditPieces(term string, max int) []string {
+	runes := []rune(term)
+	n := 2*max + 1
+	if len(runes) < n {
+		return nil
+	}
+	pieces := make([]string, 0, n)
+	start := 0
+	for i := 0; i < n; i++ {
+		// Spread the remainder over the first pieces
+		end := start + len(runes)/n
+		if i < len(runes)%n {
+			end++
+		}
+		pieces = append(pieces, string(runes[start:end]))
+		start = end
+	}
+	return pieces
+}
@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	type args struct {
+		a              string
+		b              string
+		max            int
+		transpositions bool
+	}
+	tests := []struct {
+		name string
+		args args
+		want int
+	}{
+		{"same", args{"книга", "книга", 2, false}, 0},
+		{"substitution", args{"книга", "кнога", 2, false}, 1},
+		{"insertion", args{"книга", "книгра", 2, false}, 1},
+		{"deletion", args{"книга", "кига", 2, false}, 1},
+		{"empty", args{"", "да", 2, false}, 2},
+		{"transposition", args{"книга", "кнгиа", 2, false}, 2},
+		{"damerau", args{"книга", "кнгиа", 2, true}, 1},
+		{"over max", args{"книга", "стол", 2, false}, 3},
+		{"length over max", args{"книга", "к", 2, false}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EditDistance(tt.args.a, tt.args.b, tt.args.max, tt.args.transpositions); got != tt.want {
+				t.Errorf("EditDistance() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEditPieces(t *testing.T) {
+	tests := []struct {
+		name string
+		term string
+		max  int
+		want []string
+	}{
+		{"single edit", "книга", 1, []string{"кн", "иг", "а"}},
+		{"two edits", "книга", 2, []string{"к", "н", "и", "г", "а"}},
+		{"uneven", "нига", 1, []string{"ни", "г", "а"}},
+		{"too short", "да", 1, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EditPieces(tt.term, tt.max); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("EditPieces() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEditPieces_Intact(t *testing.T) {
+	tests := []struct {
+		name      string
+		term      string
+		candidate string
+		max       int
+	}{
+		{"first letter deleted", "нига", "книга", 1},
+		{"first letters swapped", "нкига", "книга", 1},
+		{"first letters swapped twice", "нкига", "книга", 2},
+		{"boundary swapped", "книга", "кинга", 1},
+		{"last letter inserted", "книга", "книгаа", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, piece := range EditPieces(tt.term, tt.max) {
+				if strings.Contains(tt.candidate, piece) {
+					return
+				}
+			}
+			t.Errorf("EditPieces(%q) has no piece in %q", tt.term, tt.candidate)
+		})
+	}
+}
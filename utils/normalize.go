@@ -0,0 +1,42 @@
+package utils
+
+import "strings"
+
+const (
+	// combiningAcute is the stress mark put over vowels
+	combiningAcute = '\u0301'
+	// combiningGrave is the secondary stress mark
+	combiningGrave = '\u0300'
+	// combiningDiaeresis makes a decomposed ё out of е
+	combiningDiaeresis = '\u0308'
+	// softHyphen is the invisible hyphenation hint
+	softHyphen = '\u00ad'
+)
+
+// NormalizeRussian folds the orthographic variation of Russian texts, so
+// that ё becomes е and the stress marks and soft hyphens are dropped, it
+// never touches spaces, so tokenized strings stay aligned with the original
+func NormalizeRussian(s string) string {
+	// Most of the strings don't need any work done
+	if !strings.ContainsAny(s, "ёЁ\u0301\u0300\u0308\u00ad") {
+		return s
+	}
+	normalized := strings.Builder{}
+	normalized.Grow(len(s))
+	previous := rune(0)
+	for _, r := range s {
+		switch {
+		case r == 'ё':
+			r = 'е'
+		case r == 'Ё':
+			r = 'Е'
+		case r == combiningAcute || r == combiningGrave || r == softHyphen:
+			continue
+		case r == combiningDiaeresis && (previous == 'е' || previous == 'Е'):
+			continue
+		}
+		normalized.WriteRune(r)
+		previous = r
+	}
+	return normalized.String()
+}
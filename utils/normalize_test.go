@@ -0,0 +1,26 @@
+package utils
+
+import "testing"
+
+func TestNormalizeRussian(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want string
+	}{
+		{"nothing to do", "еще раз", "еще раз"},
+		{"yo", "ещё Ёлка", "еще Елка"},
+		{"decomposed yo", "еще\u0308", "еще"},
+		{"stress marks", "за\u0301мок замо\u0301к", "замок замок"},
+		{"soft hyphens", "пере\u00adнос", "перенос"},
+		{"keeps alignment", "а \u00ad б", "а  б"},
+		{"keeps other diaereses", "nai\u0308ve", "nai\u0308ve"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeRussian(tt.s); got != tt.want {
+				t.Errorf("NormalizeRussian() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package utils
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// unicodeWordClass is what \w means for us, letters of any alphabet
+	unicodeWordClass = `\p{L}\p{N}_`
+)
+
+// UnicodeRegexp is a Go regexp where \w, \W and \b work with any
+// alphabet and not only ASCII, as Go's RE2 syntax does by default
+type UnicodeRegexp struct {
+	re *regexp.Regexp
+	// boundaryStart is true if the pattern started with \b
+	boundaryStart bool
+	// boundaryEnd is true if the pattern ended with \b
+	boundaryEnd bool
+}
+
+// CompileUnicodeRegexp compiles a Perl-like pattern with Unicode-aware \w, \W
+// and \b, as RE2 has no lookarounds, \b is only supported at the pattern's edges,
+// and ^ with $ are not supported at all, as texts are searched as a whole
+func CompileUnicodeRegexp(pattern string, caseSensitive bool) (*UnicodeRegexp, error) {
+	result := &UnicodeRegexp{}
+	if strings.HasPrefix(pattern, `\b`) {
+		result.boundaryStart = true
+		pattern = pattern[2:]
+	}
+	if strings.HasSuffix(pattern, `\b`) && !strings.HasSuffix(pattern, `\\b`) {
+		result.boundaryEnd = true
+		pattern = pattern[:len(pattern)-2]
+	}
+	translated := strings.Builder{}
+	inClass := false
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			switch pattern[i] {
+			case 'w':
+				if inClass {
+					translated.WriteString(unicodeWordClass)
+				} else {
+					translated.WriteString("[" + unicodeWordClass + "]")
+				}
+			case 'W':
+				if inClass {
+					return nil, errors.New(`\W is not supported inside of brackets`)
+				}
+				translated.WriteString("[^" + unicodeWordClass + "]")
+			case 'b', 'B':
+				if !inClass {
+					return nil, errors.New(`\b is only supported at the start or the end of a pattern`)
+				}
+				translated.WriteString(`\` + string(pattern[i]))
+			default:
+				translated.WriteString(`\` + string(pattern[i]))
+			}
+			continue
+		case c == '[' && !inClass:
+			inClass = true
+			translated.WriteByte(c)
+			// A closing bracket right after the opening one is a literal
+			if i+1 < len(pattern) && pattern[i+1] == '^' {
+				i++
+				translated.WriteByte('^')
+			}
+			if i+1 < len(pattern) && pattern[i+1] == ']' {
+				i++
+				translated.WriteByte(']')
+			}
+			continue
+		case c == ']' && inClass:
+			inClass = false
+		case (c == '^' || c == '$') && !inClass:
+			return nil, errors.New(`^ and $ are not supported, use \b instead`)
+		}
+		translated.WriteByte(c)
+	}
+	flags := ""
+	if !caseSensitive {
+		flags = "(?i)"
+	}
+	re, err := regexp.Compile(flags + translated.String())
+	if err != nil {
+		return nil, err
+	}
+	result.re = re
+	return result, nil
+}
+
+// FindAllIndex returns [start, end) byte offsets of all the non-empty and
+// non-overlapping matches in s, checking the word boundaries if needed
+func (u *UnicodeRegexp) FindAllIndex(s string) [][2]int {
+	matches := make([][2]int, 0)
+	for pos := 0; pos < len(s); {
+		loc := u.re.FindStringIndex(s[pos:])
+		if loc == nil {
+			break
+		}
+		start, end := pos+loc[0], pos+loc[1]
+		if end > start && u.boundariesHold(s, start, end) {
+			matches = append(matches, [2]int{start, end})
+			pos = end
+			continue
+		}
+		// Retry right after the start, as a rejected match could hide a good one
+		_, size := utf8.DecodeRuneInString(s[start:])
+		pos = start + Max(size, 1)
+	}
+	return matches
+}
+
+// boundariesHold checks the \b conditions at the edges of a match
+func (u *UnicodeRegexp) boundariesHold(s string, start, end int) bool {
+	if u.boundaryStart {
+		before, _ := utf8.DecodeLastRuneInString(s[:start])
+		first, _ := utf8.DecodeRuneInString(s[start:])
+		if start > 0 && isWordRune(before) == isWordRune(first) {
+			return false
+		}
+		if start == 0 && !isWordRune(first) {
+			return false
+		}
+	}
+	if u.boundaryEnd {
+		last, _ := utf8.DecodeLastRuneInString(s[:end])
+		after, _ := utf8.DecodeRuneInString(s[end:])
+		if end < len(s) && isWordRune(last) == isWordRune(after) {
+			return false
+		}
+		if end == len(s) && !isWordRune(last) {
+			return false
+		}
+	}
+	return true
+}
+
+// isWordRune tells whether a rune is a \w character
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r) || r == '_'
+}
+
+// RegexForPostgres translates a Perl-like pattern into Postgres' flavor
+// of regular expressions, where word boundaries are \y instead of \b
+func RegexForPostgres(pattern string) string {
+	translated := strings.Builder{}
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] == '\\' && i+1 < len(pattern) {
+			i++
+			switch pattern[i] {
+			case 'b':
+				translated.WriteString(`\y`)
+			case 'B':
+				translated.WriteString(`\Y`)
+			default:
+				translated.WriteString(`\` + string(pattern[i]))
+			}
+			continue
+		}
+		translated.WriteByte(pattern[i])
+	}
+	return translated.String()
+}
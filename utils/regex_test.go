@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUnicodeRegexp_FindAllIndex(t *testing.T) {
+	type args struct {
+		pattern       string
+		caseSensitive bool
+		s             string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    [][2]int
+		wantErr bool
+	}{
+		{"suffix family", args{`\w+ость\b`, false, "радость и гадостью"}, [][2]int{{0, 14}}, false},
+		{"word start", args{`\bне\w+`, false, "сне неделя"}, [][2]int{{7, 19}}, false},
+		{"adjacent words", args{`\bкот\b`, false, "кот кот котик"}, [][2]int{{0, 6}, {7, 13}}, false},
+		{"case insensitive", args{`КНИГ\w*`, false, "книга Книги"}, [][2]int{{0, 10}, {11, 21}}, false},
+		{"case sensitive", args{`КНИГ\w*`, true, "книга Книги"}, [][2]int{}, false},
+		{"word class in brackets", args{`[\w-]+то`, false, "кто-то"}, [][2]int{{0, 11}}, false},
+		{"non-word", args{`\W`, false, "а , б"}, [][2]int{{2, 3}, {3, 4}, {4, 5}}, false},
+		{"inner boundary", args{`а\bб`, false, ""}, nil, true},
+		{"anchor", args{`^а`, false, ""}, nil, true},
+		{"bad pattern", args{`(а`, false, ""}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := CompileUnicodeRegexp(tt.args.pattern, tt.args.caseSensitive)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CompileUnicodeRegexp() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := u.FindAllIndex(tt.args.s); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindAllIndex() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegexForPostgres(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		want    string
+	}{
+		{"boundaries", `\w+ость\b`, `\w+ость\y`},
+		{"non-boundaries", `\Bость`, `\Yость`},
+		{"escaped backslash", `\\b`, `\\b`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RegexForPostgres(tt.pattern); got != tt.want {
+				t.Errorf("RegexForPostgres() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -44,7 +44,8 @@ func ReverseString(what string) string {
 	return string(rune)
 }
 
-// FindTokenIndex maps a found index to a tokenized slice index
+// FindTokenIndex maps a found index to a tokenized slice index, an index
+// of a space between two tokens is mapped to the token on its left
 func FindTokenIndex(tokens []string, index int) int {
 	currentSum := 0
 	for i, v := range tokens {
@@ -53,5 +54,9 @@ func FindTokenIndex(tokens []string, index int) int {
 		}
 		currentSum += len(v) + 1
 	}
+	// The index can still point into the last token
+	if index >= 0 && index < currentSum {
+		return len(tokens) - 1
+	}
 	return -1
 }
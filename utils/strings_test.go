@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFindTokenIndex(t *testing.T) {
+	tokens := strings.Split("Я люблю книги .", " ")
+	type args struct {
+		tokens []string
+		index  int
+	}
+	tests := []struct {
+		name string
+		args args
+		want int
+	}{
+		{"first", args{tokens, 0}, 0},
+		{"space", args{tokens, 2}, 0},
+		{"middle", args{tokens, 3}, 1},
+		{"inside", args{tokens, 10}, 1},
+		{"last", args{tokens, 25}, 3},
+		{"end", args{tokens, 26}, 3},
+		{"out of bounds", args{tokens, 27}, -1},
+		{"negative", args{tokens, -1}, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FindTokenIndex(tt.args.tokens, tt.args.index); got != tt.want {
+				t.Errorf("FindTokenIndex() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
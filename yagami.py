@@ -104,6 +104,7 @@ def p_analyze(
     # num_sentences = len(sent_tokens)
 
     num_sentences = len([sent for sent in doc.sents])
+    sentences = " ".join(([str(sent.start) for sent in doc.sents]))
     num_words = len([True for token in doc if token.is_alpha])
 
     shapes = " ".join(([token.shape_ for token in doc]))
@@ -125,6 +126,7 @@ def p_analyze(
         "name": crawler,
         "num_words": num_words,
         "num_sentences": num_sentences,
+        "sentences": sentences,
     }
 
     final_json = json.dumps(to_return, ensure_ascii=False, sort_keys=True)